@@ -5,6 +5,8 @@ import (
 	"runtime"
 	"sync"
 	"time"
+
+	"github.com/xtfly/gokits/gtime"
 )
 
 const (
@@ -18,7 +20,8 @@ type Item struct {
 	Expiration int64
 }
 
-// Expired Returns true if the item has expired.
+// Expired Returns true if the item has expired by wall time. The item does not know
+// the clock of its cache, Get and DeleteExpired check the expiration by that clock.
 func (item Item) Expired() bool {
 	if item.Expiration == 0 {
 		return false
@@ -36,6 +39,7 @@ type cache struct {
 	mu        sync.RWMutex
 	onEvicted func(string, interface{})
 	janitor   *janitor
+	clock     gtime.Clock
 }
 
 type janitor struct {
@@ -49,7 +53,7 @@ func (c *cache) Set(k string, x interface{}, d time.Duration) {
 	// "Inlining" of set
 	var e int64
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.clock.Now().Add(d).UnixNano()
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -62,7 +66,7 @@ func (c *cache) Set(k string, x interface{}, d time.Duration) {
 func (c *cache) set(k string, x interface{}, d time.Duration) {
 	var e int64
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.clock.Now().Add(d).UnixNano()
 	}
 	c.items[k] = Item{
 		Object:     x,
@@ -107,7 +111,7 @@ func (c *cache) Get(k string) (interface{}, bool) {
 		return nil, false
 	}
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.clock.Now().UnixNano() > item.Expiration {
 			return nil, false
 		}
 	}
@@ -121,7 +125,7 @@ func (c *cache) get(k string) (interface{}, bool) {
 	}
 	// "Inlining" of Expired
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.clock.Now().UnixNano() > item.Expiration {
 			return nil, false
 		}
 	}
@@ -157,7 +161,7 @@ type keyAndValue struct {
 // Delete all expired items from the cache.
 func (c *cache) DeleteExpired() {
 	var evictedItems []keyAndValue
-	now := time.Now().UnixNano()
+	now := c.clock.Now().UnixNano()
 	c.mu.Lock()
 	for k, v := range c.items {
 		// "Inlining" of expired
@@ -213,15 +217,14 @@ func (c *cache) UpdateExpiration(k string, Expiration int64) error {
 }
 
 func (j *janitor) run(c *cache) {
-	j.stop = make(chan bool)
-	ticker := time.NewTicker(j.Interval)
-	ticker.Stop()
+	ticker := c.clock.NewTicker(j.Interval)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			c.DeleteExpired()
 		case <-j.stop:
-			break
+			return
 		}
 	}
 }
@@ -233,20 +236,22 @@ func stopJanitor(c *Cache) {
 func runJanitor(c *cache, ci time.Duration) {
 	j := &janitor{
 		Interval: ci,
+		stop:     make(chan bool),
 	}
 	c.janitor = j
 	go j.run(c)
 }
 
-func newCache(m map[string]Item) *cache {
+func newCache(m map[string]Item, clock gtime.Clock) *cache {
 	c := &cache{
 		items: m,
+		clock: clock,
 	}
 	return c
 }
 
-func newCacheWithJanitor(ci time.Duration, m map[string]Item) *Cache {
-	c := newCache(m)
+func newCacheWithJanitor(ci time.Duration, m map[string]Item, clock gtime.Clock) *Cache {
+	c := newCache(m, clock)
 	// This trick ensures that the janitor goroutine (which--granted it
 	// was enabled--is running DeleteExpired on c forever) does not keep
 	// the returned C object from being garbage collected. When it is
@@ -264,6 +269,12 @@ func newCacheWithJanitor(ci time.Duration, m map[string]Item) *Cache {
 // If the cleanup interval is less than one, expired items are not
 // deleted from the cache before calling c.DeleteExpired().
 func NewCache(cleanupInterval time.Duration) *Cache {
+	return NewCacheWithClock(cleanupInterval, gtime.RealClock)
+}
+
+// NewCacheWithClock return a new cache whose expiration and cleanup are driven by clock,
+// e.g. gtime.FakeClock in tests.
+func NewCacheWithClock(cleanupInterval time.Duration, clock gtime.Clock) *Cache {
 	items := make(map[string]Item)
-	return newCacheWithJanitor(cleanupInterval, items)
+	return newCacheWithJanitor(cleanupInterval, items, clock)
 }
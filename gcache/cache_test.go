@@ -0,0 +1,32 @@
+package gcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+func TestCacheJanitor(t *testing.T) {
+	clock := gtime.NewFakeClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewCacheWithClock(time.Minute, clock)
+	evicted := make(chan string, 1)
+	c.OnEvicted(func(k string, v interface{}) { evicted <- k })
+
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, 0)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+
+	select {
+	case k := <-evicted:
+		if k != "a" {
+			t.Fatalf("Should evict the expired item, but (%s)", k)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Should evict the expired item by janitor")
+	}
+	if n := c.ItemCount(); n != 1 {
+		t.Fatalf("Should keep the item without expiration, but (%d)", n)
+	}
+}
@@ -0,0 +1,192 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrBrokenBarrier = errors.New("barrier is broken")
+)
+
+type generation struct {
+	broken bool
+}
+
+// CyclicBarrier allows a set of goroutines to all wait for each other to reach a common barrier point,
+// the barrier can be re-used after the waiting goroutines are released
+type CyclicBarrier struct {
+	parties int
+	count   int
+	action  func()
+	gen     *generation
+	mu      sync.Mutex
+	cond    *TimeoutCond
+}
+
+// NewCyclicBarrier creates a CyclicBarrier that will trip when the given number of parties are waiting,
+// the optional action is executed by the last goroutine arriving before the others are released
+func NewCyclicBarrier(parties int, action func()) *CyclicBarrier {
+	if parties <= 0 {
+		panic(errors.New("parties must > 0"))
+	}
+	b := &CyclicBarrier{
+		parties: parties,
+		count:   parties,
+		action:  action,
+		gen:     &generation{},
+	}
+	b.cond = NewTimeoutCond(&b.mu)
+	return b
+}
+
+// Await waits until all parties have invoked Await on this barrier, or ctx is done.
+// It returns the arrival index of the current goroutine, parties-1 indicates the first
+// to arrive and zero indicates the last to arrive. If ctx is done, the barrier is broken
+// and ctx.Err() is returned, the other waiting goroutines return ErrBrokenBarrier.
+func (b *CyclicBarrier) Await(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	// the parties arriving while the action is running join the next generation
+	if b.count == 0 && !b.gen.broken {
+		if err := b.cond.WaitFor(ctx, func() bool { return b.count != 0 || b.gen.broken }); err != nil {
+			b.mu.Unlock()
+			return 0, err
+		}
+	}
+	gen := b.gen
+	if gen.broken {
+		b.mu.Unlock()
+		return 0, ErrBrokenBarrier
+	}
+
+	b.count--
+	index := b.count
+	if index == 0 {
+		b.mu.Unlock()
+		return 0, b.trip(gen)
+	}
+
+	defer b.mu.Unlock()
+	if err := b.cond.WaitFor(ctx, func() bool { return gen != b.gen || gen.broken }); err != nil {
+		b.breakBarrier()
+		b.cond.Broadcast()
+		return index, err
+	}
+	if gen.broken {
+		return index, ErrBrokenBarrier
+	}
+	return index, nil
+}
+
+// trip runs the action without holding lock and releases the waiting parties, the barrier
+// is broken if the action panics, and the panic is propagated to the last party
+func (b *CyclicBarrier) trip(gen *generation) (err error) {
+	done := false
+	defer func() {
+		b.mu.Lock()
+		if b.gen != gen {
+			// reset by the action
+			err = ErrBrokenBarrier
+		} else if !done {
+			b.breakBarrier()
+		} else {
+			b.nextGeneration()
+		}
+		b.mu.Unlock()
+		b.cond.Broadcast()
+	}()
+
+	if b.action != nil {
+		b.action()
+	}
+	done = true
+	return nil
+}
+
+// Reset breaks the current generation and resets the barrier to its initial state,
+// the goroutines waiting on the barrier return ErrBrokenBarrier
+func (b *CyclicBarrier) Reset() {
+	b.mu.Lock()
+	b.breakBarrier()
+	b.nextGeneration()
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// IsBroken queries whether this barrier is in a broken state
+func (b *CyclicBarrier) IsBroken() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen.broken
+}
+
+// NumberWaiting return the number of parties currently waiting at the barrier
+func (b *CyclicBarrier) NumberWaiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.parties - b.count
+}
+
+// Parties return the number of parties required to trip this barrier
+func (b *CyclicBarrier) Parties() int {
+	return b.parties
+}
+
+func (b *CyclicBarrier) nextGeneration() {
+	b.count = b.parties
+	b.gen = &generation{}
+}
+
+func (b *CyclicBarrier) breakBarrier() {
+	b.gen.broken = true
+	b.count = b.parties
+}
+
+// CountDownLatch allows one or more goroutines to wait until a set of operations
+// being performed in other goroutines completes
+type CountDownLatch struct {
+	count int
+	mu    sync.Mutex
+	cond  *TimeoutCond
+}
+
+// NewCountDownLatch creates a CountDownLatch initialized with the given count
+func NewCountDownLatch(count int) *CountDownLatch {
+	if count < 0 {
+		panic(errors.New("count must >= 0"))
+	}
+	l := &CountDownLatch{count: count}
+	l.cond = NewTimeoutCond(&l.mu)
+	return l
+}
+
+// CountDown decrements the count of the latch, releasing all waiting goroutines if the count reaches zero
+func (l *CountDownLatch) CountDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		l.cond.Broadcast()
+	}
+}
+
+// Count return the current count
+func (l *CountDownLatch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Await waits until the latch has counted down to zero, or ctx is done.
+// On failure, returns ctx.Err().
+func (l *CountDownLatch) Await(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.cond.WaitFor(ctx, func() bool { return l.count == 0 })
+}
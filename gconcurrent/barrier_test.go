@@ -0,0 +1,118 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCyclicBarrier(t *testing.T) {
+	var actions int32
+	b := NewCyclicBarrier(3, func() { atomic.AddInt32(&actions, 1) })
+
+	for round := 0; round < 3; round++ {
+		wait := sync.WaitGroup{}
+		indexes := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				index, err := b.Await(context.Background())
+				assert.Nil(t, err)
+				indexes <- index
+			}()
+		}
+		wait.Wait()
+		close(indexes)
+
+		sum := 0
+		for index := range indexes {
+			sum += index
+		}
+		assert.Equal(t, 3, sum)
+	}
+	assert.Equal(t, int32(3), actions)
+	assert.Equal(t, 0, b.NumberWaiting())
+}
+
+func TestCyclicBarrierBroken(t *testing.T) {
+	b := NewCyclicBarrier(3, nil)
+
+	ch := make(chan error, 1)
+	go func() {
+		_, err := b.Await(context.Background())
+		ch <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, b.NumberWaiting())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := b.Await(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, ErrBrokenBarrier, <-ch)
+	assert.True(t, b.IsBroken())
+
+	_, err = b.Await(context.Background())
+	assert.Equal(t, ErrBrokenBarrier, err)
+
+	b.Reset()
+	assert.False(t, b.IsBroken())
+	assert.Equal(t, 3, b.Parties())
+}
+
+func TestCyclicBarrierAction(t *testing.T) {
+	// the action could query the barrier without deadlock, and the panic breaks the barrier
+	waiting := 0
+	var panicked *CyclicBarrier
+	panicked = NewCyclicBarrier(2, func() {
+		waiting = panicked.NumberWaiting()
+		panic("boom")
+	})
+
+	ch := make(chan error, 1)
+	go func() {
+		_, err := panicked.Await(context.Background())
+		ch <- err
+	}()
+	for panicked.NumberWaiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Panics(t, func() { panicked.Await(context.Background()) })
+	assert.Equal(t, ErrBrokenBarrier, <-ch)
+	assert.Equal(t, 2, waiting)
+	assert.True(t, panicked.IsBroken())
+
+	panicked.Reset()
+	assert.False(t, panicked.IsBroken())
+}
+
+func TestCountDownLatch(t *testing.T) {
+	l := NewCountDownLatch(3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Await(ctx))
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			assert.Nil(t, l.Await(context.Background()))
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		l.CountDown()
+	}
+	wait.Wait()
+
+	l.CountDown()
+	assert.Equal(t, 0, l.Count())
+	assert.Nil(t, l.Await(context.Background()))
+}
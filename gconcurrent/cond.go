@@ -2,22 +2,29 @@ package gconcurrent
 
 import (
 	"context"
+	"errors"
 	"math"
 	"strconv"
 	"sync"
 	"sync/atomic"
 )
 
+// ErrInterrupted is returned by WaitFor if the condition is interrupted
+var ErrInterrupted = errors.New("condition is interrupted")
+
 // TimeoutCond is a sync.Cond  improve for support wait timeout.
 type TimeoutCond struct {
 	hasWaiters uint64
 	L          sync.Locker
 	signal     chan int
+
+	mu        sync.Mutex    // guard broadcast, so Broadcast could be called without L
+	broadcast chan struct{} // closed and replaced by Broadcast
 }
 
 // NewTimeoutCond return a new TimeoutCond
 func NewTimeoutCond(l sync.Locker) *TimeoutCond {
-	cond := TimeoutCond{L: l, signal: make(chan int, 0)}
+	cond := TimeoutCond{L: l, signal: make(chan int, 0), broadcast: make(chan struct{})}
 	return &cond
 }
 
@@ -42,11 +49,19 @@ func (cond *TimeoutCond) HasWaiters() bool {
 	return atomic.LoadUint64(&cond.hasWaiters) > 0
 }
 
-// Wait waits for a signal, or for the context do be done. Returns true if signaled.
+// WaiterCount return the number of goroutines waiting on this condition
+func (cond *TimeoutCond) WaiterCount() int {
+	return int(atomic.LoadUint64(&cond.hasWaiters))
+}
+
+// Wait waits for a signal, a broadcast, or for the context do be done. Returns true if interrupted.
 func (cond *TimeoutCond) Wait(ctx context.Context) bool {
 	cond.addWaiter()
 	//copy signal in lock, avoid data race with Interrupt
 	ch := cond.signal
+	cond.mu.Lock()
+	bc := cond.broadcast
+	cond.mu.Unlock()
 	//wait should unlock mutex,  if not will cause deadlock
 	cond.L.Unlock()
 	defer cond.removeWaiter()
@@ -55,11 +70,32 @@ func (cond *TimeoutCond) Wait(ctx context.Context) bool {
 	select {
 	case _, ok := <-ch:
 		return !ok
+	case <-bc:
+		return false
 	case <-ctx.Done():
 		return false
 	}
 }
 
+// WaitFor waits until the predicate is satisfied, or for the context do be done,
+// or the condition is interrupted. The predicate is checked with L locked, so it
+// is rechecked after every wakeup, spurious wakeups are ignored.
+// Returns nil if the predicate is satisfied, otherwise ctx.Err() or ErrInterrupted.
+func (cond *TimeoutCond) WaitFor(ctx context.Context, predicate func() bool) error {
+	for !predicate() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if cond.Wait(ctx) {
+			if predicate() {
+				return nil
+			}
+			return ErrInterrupted
+		}
+	}
+	return nil
+}
+
 // Signal wakes one goroutine waiting on c, if there is any.
 func (cond *TimeoutCond) Signal() {
 	select {
@@ -68,6 +104,15 @@ func (cond *TimeoutCond) Signal() {
 	}
 }
 
+// Broadcast wakes all goroutines waiting on c, it is allowed but not required
+// for the caller to hold L during the call.
+func (cond *TimeoutCond) Broadcast() {
+	cond.mu.Lock()
+	defer cond.mu.Unlock()
+	close(cond.broadcast)
+	cond.broadcast = make(chan struct{})
+}
+
 // Interrupt goroutine wait on this TimeoutCond
 func (cond *TimeoutCond) Interrupt() {
 	cond.L.Lock()
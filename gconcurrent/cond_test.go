@@ -231,3 +231,122 @@ func TestSignalNoWait(t *testing.T) {
 	obj := NewLockTestObject(t)
 	obj.cond.Signal()
 }
+
+func TestBroadcast(t *testing.T) {
+	t.Parallel()
+
+	obj := NewLockTestObject(t)
+	count := 5
+	wait := sync.WaitGroup{}
+	wait.Add(count)
+	ch := make(chan bool, count)
+	for i := 0; i < count; i++ {
+		go func() {
+			ch <- obj.lockAndWait()
+			wait.Done()
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, count, obj.cond.WaiterCount())
+
+	obj.cond.Broadcast()
+	wait.Wait()
+	assert.Equal(t, 0, obj.cond.WaiterCount())
+	for i := 0; i < count; i++ {
+		assert.False(t, <-ch, "expect %v not interrupted", i)
+	}
+}
+
+func TestBroadcastNoWait(t *testing.T) {
+	t.Parallel()
+
+	obj := NewLockTestObject(t)
+	obj.cond.Broadcast()
+	assert.Equal(t, 0, obj.cond.WaiterCount())
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	t.Parallel()
+
+	obj := NewLockTestObject(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	obj.lock.Lock()
+	err := obj.cond.WaitFor(ctx, func() bool { return false })
+	obj.lock.Unlock()
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestWaitForInterrupted(t *testing.T) {
+	t.Parallel()
+
+	obj := NewLockTestObject(t)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		obj.cond.Interrupt()
+	}()
+
+	obj.lock.Lock()
+	err := obj.cond.WaitFor(context.Background(), func() bool { return false })
+	obj.lock.Unlock()
+	assert.Equal(t, ErrInterrupted, err)
+}
+
+func TestWaitForContention(t *testing.T) {
+	t.Parallel()
+
+	obj := NewLockTestObject(t)
+	producers, consumers, items := 8, 32, 200
+	available := 0
+	consumed := 0
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < consumers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for {
+				obj.lock.Lock()
+				err := obj.cond.WaitFor(context.Background(), func() bool {
+					return available > 0 || consumed == producers*items
+				})
+				if !assert.Nil(t, err) {
+					obj.lock.Unlock()
+					return
+				}
+				if available == 0 {
+					obj.lock.Unlock()
+					obj.cond.Broadcast()
+					return
+				}
+				available--
+				consumed++
+				obj.lock.Unlock()
+				obj.cond.Broadcast()
+			}
+		}()
+	}
+
+	for i := 0; i < producers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < items; j++ {
+				obj.lock.Lock()
+				available++
+				obj.cond.Signal()
+				if j%2 == 0 {
+					obj.cond.Broadcast()
+				}
+				obj.lock.Unlock()
+			}
+			obj.cond.Broadcast()
+		}()
+	}
+
+	wait.Wait()
+	assert.Equal(t, producers*items, consumed)
+	assert.Equal(t, 0, available)
+	assert.Equal(t, 0, obj.cond.WaiterCount())
+}
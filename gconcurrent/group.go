@@ -0,0 +1,189 @@
+package gconcurrent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// TaskFunc is a sub task function will execute by Group
+type TaskFunc func(context.Context) error
+
+// GroupOption is the task group parameter
+type GroupOption struct {
+	// Pool execute the sub tasks if it is set, otherwise start a goroutine for each sub task.
+	// The sub task fails with ErrShutdown if the pool is shutdown
+	Pool WorkerPool `json:"-"`
+	// Limit is the max number of active sub tasks, zero or negative value indicates no limit
+	Limit int `json:"limit" yaml:"limit"`
+	// MultiError collect errors of all sub tasks and do not cancel the others on error
+	MultiError bool `json:"multi_error" yaml:"multi_error"`
+	// PanicFunc process the panic which throw in sub task, the panic is also returned as PanicError
+	PanicFunc PanicFunc `json:"-"`
+}
+
+// PanicError is the error of a sub task which throw a panic
+type PanicError struct {
+	Recovered interface{}
+	FuncName  string
+}
+
+// Error implements error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.FuncName, e.Recovered)
+}
+
+// MultiError is the errors of sub tasks returned by Group in multi error mode
+type MultiError []error
+
+// Error implements error interface
+func (me MultiError) Error() string {
+	msgs := make([]string, 0, len(me))
+	for _, err := range me {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(me), strings.Join(msgs, "; "))
+}
+
+// Group is a collection of sub tasks working on a common task,
+// the first error cancels the context of group, and is returned by Wait
+type Group struct {
+	option GroupOption
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	errMux sync.Mutex
+	err    error
+	errs   MultiError
+}
+
+// NewGroup creates a Group and a derived context from ctx,
+// the derived context is canceled the first time a sub task returns error or Wait returns
+func NewGroup(ctx context.Context, opt ...GroupOption) (*Group, context.Context) {
+	g := &Group{}
+	if len(opt) >= 1 {
+		g.option = opt[0]
+	}
+
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if g.option.Limit > 0 {
+		g.sem = make(chan struct{}, g.option.Limit)
+	}
+	return g, g.ctx
+}
+
+// SetLimit limits the number of active sub tasks to at most n,
+// zero or negative value indicates no limit. it must not be called when any sub task is active
+func (g *Group) SetLimit(n int) {
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("modify limit while %v sub tasks are still active", len(g.sem)))
+	}
+	if n <= 0 {
+		g.sem = nil
+		return
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go calls the given function in a new goroutine or a worker of pool,
+// it blocks until the sub task can be added without exceeding the limit
+func (g *Group) Go(f TaskFunc) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(f)
+}
+
+// TryGo calls the given function only if the number of active sub tasks is below the limit,
+// return whether the sub task was started
+func (g *Group) TryGo(f TaskFunc) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(f)
+	return true
+}
+
+// Wait blocks until all sub tasks have returned, then returns the first error,
+// or a MultiError contains all errors in multi error mode
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.errMux.Lock()
+	defer g.errMux.Unlock()
+	if g.option.MultiError {
+		if len(g.errs) == 0 {
+			return nil
+		}
+		return g.errs
+	}
+	return g.err
+}
+
+func (g *Group) start(f TaskFunc) {
+	g.wg.Add(1)
+	if g.option.Pool != nil {
+		err := g.option.Pool.TryExecute(func(context.Context) {
+			g.run(f)
+		})
+		// the sub task fails with the error of pool if it is not started
+		if err != nil {
+			g.setError(err)
+			g.done()
+		}
+		return
+	}
+	go g.run(f)
+}
+
+func (g *Group) run(f TaskFunc) {
+	defer g.done()
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		funcName := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+		if g.option.PanicFunc != nil {
+			g.option.PanicFunc(recovered, funcName)
+		}
+		g.setError(&PanicError{Recovered: recovered, FuncName: funcName})
+	}()
+
+	if err := f(g.ctx); err != nil {
+		g.setError(err)
+	}
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+func (g *Group) setError(err error) {
+	g.errMux.Lock()
+	defer g.errMux.Unlock()
+
+	if g.option.MultiError {
+		g.errs = append(g.errs, err)
+		return
+	}
+
+	if g.err == nil {
+		g.err = err
+		g.cancel()
+	}
+}
@@ -0,0 +1,120 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupFirstError(t *testing.T) {
+	g, ctx := NewGroup(context.Background())
+	errFirst := errors.New("first")
+
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+
+	assert.Equal(t, errFirst, g.Wait())
+	assert.NotNil(t, ctx.Err())
+}
+
+func TestGroupLimitOnPool(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 4, MaxWorkerNum: 8, QueueSize: 100})
+	g, _ := NewGroup(context.Background(), GroupOption{Pool: w})
+	g.SetLimit(2)
+
+	var running, maxRunning int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+
+	assert.Nil(t, g.Wait())
+	assert.True(t, maxRunning <= 2)
+	w.Shutdown(context.Background())
+}
+
+func TestGroupPoolShutdown(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 1, QueueSize: 10})
+	w.Shutdown(context.Background())
+
+	g, _ := NewGroup(context.Background(), GroupOption{Pool: w, Limit: 1})
+	for i := 0; i < 2; i++ {
+		g.Go(func(ctx context.Context) error { return nil })
+	}
+	assert.Equal(t, ErrShutdown, g.Wait())
+}
+
+func TestGroupTryGo(t *testing.T) {
+	g, _ := NewGroup(context.Background(), GroupOption{Limit: 1})
+	evt := make(chan struct{})
+
+	assert.True(t, g.TryGo(func(ctx context.Context) error {
+		<-evt
+		return nil
+	}))
+	assert.False(t, g.TryGo(func(ctx context.Context) error { return nil }))
+	assert.Panics(t, func() { g.SetLimit(2) })
+
+	close(evt)
+	assert.Nil(t, g.Wait())
+	assert.True(t, g.TryGo(func(ctx context.Context) error { return nil }))
+	assert.Nil(t, g.Wait())
+}
+
+func TestGroupPanic(t *testing.T) {
+	var panicNum int32
+	pf := func(recovered interface{}, funcName string) {
+		atomic.AddInt32(&panicNum, 1)
+	}
+	g, _ := NewGroup(context.Background(), GroupOption{PanicFunc: pf})
+
+	g.Go(func(ctx context.Context) error {
+		panic("group panic")
+	})
+
+	err := g.Wait()
+	pe, ok := err.(*PanicError)
+	assert.True(t, ok)
+	assert.Equal(t, "group panic", pe.Recovered)
+	assert.Equal(t, int32(1), panicNum)
+}
+
+func TestGroupMultiError(t *testing.T) {
+	g, ctx := NewGroup(context.Background(), GroupOption{MultiError: true})
+
+	for i := 0; i < 3; i++ {
+		g.Go(func(ctx context.Context) error {
+			return errors.New("failed")
+		})
+	}
+	g.Go(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return ctx.Err()
+	})
+
+	err := g.Wait()
+	me, ok := err.(MultiError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(me))
+	assert.NotNil(t, ctx.Err())
+}
@@ -0,0 +1,95 @@
+package gconcurrent
+
+import (
+	"time"
+)
+
+// bucket i counts the durations in (2^(i-1), 2^i] microseconds
+const histogramBuckets = 40
+
+// LatencyStats is the distribution of a duration metric
+type LatencyStats struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// histogram is a exponential buckets histogram, it is not concurrent safe
+type histogram struct {
+	buckets [histogramBuckets]int64
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+func (h *histogram) add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	idx := 0
+	for bound := time.Microsecond; d > bound && idx < histogramBuckets-1; bound *= 2 {
+		idx++
+	}
+	h.buckets[idx]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// percentile return the upper bound of the bucket which contains the p-th percentile
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int64(float64(h.count)*p + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var total int64
+	bound := time.Microsecond
+	for idx := 0; idx < histogramBuckets; idx++ {
+		total += h.buckets[idx]
+		if total >= rank {
+			break
+		}
+		bound *= 2
+	}
+
+	if bound > h.max {
+		return h.max
+	}
+	if bound < h.min {
+		return h.min
+	}
+	return bound
+}
+
+func (h *histogram) stats() LatencyStats {
+	if h.count == 0 {
+		return LatencyStats{}
+	}
+
+	return LatencyStats{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		Mean:  h.sum / time.Duration(h.count),
+		P50:   h.percentile(0.5),
+		P90:   h.percentile(0.9),
+		P99:   h.percentile(0.99),
+	}
+}
@@ -0,0 +1,233 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBacklogFull = errors.New("key backlog is full")
+)
+
+// KeyedExecutor executes jobs with the same key serially in FIFO order,
+// jobs with different keys are executed in parallel by the WorkerPool.
+type KeyedExecutor interface {
+	// Execute add job function to the backlog of key,
+	// return ErrBacklogFull if the backlog of key is full, ErrShutdown if the pool is shutdown
+	Execute(key string, f JobFunc) error
+
+	// Submit add job function to the backlog of key with a timeout timer,
+	// wait for free space of the backlog if it is full, return ErrShutdown if the pool is shutdown
+	Submit(key string, f JobFunc, timeout time.Duration) error
+
+	// Pending return the number of jobs of key which waiting for executing
+	Pending(key string) int
+
+	// KeyNum return the number of keys which have jobs waiting or running
+	KeyNum() int
+}
+
+// KeyedOption is the keyed executor parameter
+type KeyedOption struct {
+	MaxPending int `json:"max_pending" yaml:"max_pending"`
+}
+
+type keyedQueue struct {
+	key     string
+	jobs    []JobFunc
+	running bool
+	space   chan struct{} // closed when a job taken from jobs, created by waiters
+}
+
+type keyedExecutor struct {
+	pool   WorkerPool
+	option KeyedOption
+
+	mux    sync.Mutex
+	queues map[string]*keyedQueue
+}
+
+// NewKeyedExecutor creates a instance of KeyedExecutor on the given WorkerPool
+// default parameters:
+//   maxPending: 64
+func NewKeyedExecutor(pool WorkerPool, opt ...KeyedOption) KeyedExecutor {
+	e := &keyedExecutor{
+		pool: pool,
+		option: KeyedOption{
+			MaxPending: 64,
+		},
+		queues: make(map[string]*keyedQueue),
+	}
+
+	if len(opt) >= 1 {
+		e.option = opt[0]
+	}
+	if e.option.MaxPending <= 0 {
+		e.option.MaxPending = 64
+	}
+
+	return e
+}
+
+func (e *keyedExecutor) Execute(key string, jf JobFunc) error {
+	e.mux.Lock()
+	q := e.queue(key)
+	if len(q.jobs) >= e.option.MaxPending {
+		e.release(q)
+		e.mux.Unlock()
+		return ErrBacklogFull
+	}
+	return e.enqueue(q, jf)
+}
+
+func (e *keyedExecutor) Submit(key string, jf JobFunc, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	e.mux.Lock()
+	q := e.queue(key)
+	for len(q.jobs) >= e.option.MaxPending {
+		if q.space == nil {
+			q.space = make(chan struct{})
+		}
+		space := q.space
+		e.mux.Unlock()
+
+		select {
+		case <-space:
+		case <-timer.C:
+			e.mux.Lock()
+			e.release(q)
+			e.mux.Unlock()
+			return ErrTimeout
+		}
+
+		e.mux.Lock()
+		// the queue may be released and replaced by another one
+		q = e.queue(key)
+	}
+	return e.enqueue(q, jf)
+}
+
+func (e *keyedExecutor) Pending(key string) int {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if q, ok := e.queues[key]; ok {
+		return len(q.jobs)
+	}
+	return 0
+}
+
+func (e *keyedExecutor) KeyNum() int {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return len(e.queues)
+}
+
+// queue return the queue of key, create it if not exist. must hold lock
+func (e *keyedExecutor) queue(key string) *keyedQueue {
+	q, ok := e.queues[key]
+	if !ok {
+		q = &keyedQueue{key: key}
+		e.queues[key] = q
+	}
+	return q
+}
+
+// release remove the queue if no job is waiting or running. must hold lock
+func (e *keyedExecutor) release(q *keyedQueue) {
+	if !q.running && len(q.jobs) == 0 && q.space == nil {
+		delete(e.queues, q.key)
+	}
+}
+
+// enqueue add job to the queue and dispatch the queue to pool if it is idle,
+// must hold lock, and the lock will be released
+func (e *keyedExecutor) enqueue(q *keyedQueue, jf JobFunc) error {
+	q.jobs = append(q.jobs, jf)
+	if q.running {
+		e.mux.Unlock()
+		return nil
+	}
+	q.running = true
+	e.mux.Unlock()
+
+	return e.dispatch(q)
+}
+
+// dispatch the queue to pool, the jobs of queue are dropped if the pool is shutdown
+func (e *keyedExecutor) dispatch(q *keyedQueue) error {
+	err := e.pool.TryExecute(func(ctx context.Context) {
+		e.drain(ctx, q)
+	})
+	if err != nil {
+		e.mux.Lock()
+		q.jobs = nil
+		q.running = false
+		if q.space != nil {
+			close(q.space)
+			q.space = nil
+		}
+		e.release(q)
+		e.mux.Unlock()
+	}
+	return err
+}
+
+// drain execute the jobs of queue one by one until it is empty,
+// so only one worker goroutine is used by a key at any time
+func (e *keyedExecutor) drain(ctx context.Context, q *keyedQueue) {
+	for {
+		jf := e.next(q)
+		if jf == nil {
+			return
+		}
+		e.executeOne(ctx, q, jf)
+	}
+}
+
+func (e *keyedExecutor) next(q *keyedQueue) JobFunc {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if len(q.jobs) == 0 {
+		q.running = false
+		e.release(q)
+		return nil
+	}
+
+	jf := q.jobs[0]
+	q.jobs[0] = nil
+	q.jobs = q.jobs[1:]
+	if q.space != nil {
+		close(q.space)
+		q.space = nil
+	}
+	return jf
+}
+
+func (e *keyedExecutor) executeOne(ctx context.Context, q *keyedQueue, jf JobFunc) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		// continue the remaining jobs of key on another worker,
+		// and rethrow panic so that the pool could process it
+		e.mux.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			e.release(q)
+			e.mux.Unlock()
+		} else {
+			e.mux.Unlock()
+			go e.dispatch(q)
+		}
+		panic(recovered)
+	}()
+
+	jf(ctx)
+}
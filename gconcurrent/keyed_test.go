@@ -0,0 +1,122 @@
+package gconcurrent
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedExecutorOrder(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 4, MaxWorkerNum: 8, QueueSize: 100})
+	e := NewKeyedExecutor(w, KeyedOption{MaxPending: 1000})
+
+	var mux sync.Mutex
+	results := make(map[string][]int)
+	wait := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		for k := 0; k < 4; k++ {
+			key, seq := strconv.Itoa(k), i
+			wait.Add(1)
+			err := e.Execute(key, func(ctx context.Context) {
+				defer wait.Done()
+				mux.Lock()
+				results[key] = append(results[key], seq)
+				mux.Unlock()
+			})
+			assert.Nil(t, err)
+		}
+	}
+	wait.Wait()
+
+	for k := 0; k < 4; k++ {
+		seqs := results[strconv.Itoa(k)]
+		assert.Equal(t, 100, len(seqs))
+		for i, seq := range seqs {
+			assert.Equal(t, i, seq)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, e.KeyNum())
+	w.Shutdown(context.Background())
+}
+
+func TestKeyedExecutorSerial(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 4, MaxWorkerNum: 8, QueueSize: 100})
+	e := NewKeyedExecutor(w)
+
+	var running, maxRunning int32
+	wait := sync.WaitGroup{}
+	wait.Add(10)
+	for i := 0; i < 10; i++ {
+		err := e.Execute("key", func(ctx context.Context) {
+			defer wait.Done()
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+		assert.Nil(t, err)
+	}
+	wait.Wait()
+	assert.Equal(t, int32(1), maxRunning)
+	w.Shutdown(context.Background())
+}
+
+func TestKeyedExecutorBacklogFull(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 1, QueueSize: 10})
+	e := NewKeyedExecutor(w, KeyedOption{MaxPending: 1})
+	evt := make(chan struct{})
+
+	assert.Nil(t, e.Execute("key", func(ctx context.Context) { <-evt }))
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, e.Execute("key", func(ctx context.Context) {}))
+	assert.Equal(t, 1, e.Pending("key"))
+	assert.Equal(t, ErrBacklogFull, e.Execute("key", func(ctx context.Context) {}))
+	assert.Equal(t, ErrTimeout, e.Submit("key", func(ctx context.Context) {}, 5*time.Millisecond))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(evt)
+	}()
+	assert.Nil(t, e.Submit("key", func(ctx context.Context) {}, time.Second))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, e.KeyNum())
+	w.Shutdown(context.Background())
+}
+
+func TestKeyedExecutorPanic(t *testing.T) {
+	var panicNum int32
+	pf := func(recovered interface{}, funcName string) {
+		atomic.AddInt32(&panicNum, 1)
+	}
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 2, QueueSize: 10, PanicFunc: pf})
+	e := NewKeyedExecutor(w)
+
+	evt := make(chan struct{})
+	assert.Nil(t, e.Execute("key", func(ctx context.Context) { panic("keyed panic") }))
+	assert.Nil(t, e.Execute("key", func(ctx context.Context) { close(evt) }))
+
+	<-evt
+	assert.Equal(t, int32(1), atomic.LoadInt32(&panicNum))
+	w.Shutdown(context.Background())
+}
+
+func TestKeyedExecutorShutdown(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 1, QueueSize: 10})
+	e := NewKeyedExecutor(w)
+	w.Shutdown(context.Background())
+
+	assert.Equal(t, ErrShutdown, e.Execute("key", func(ctx context.Context) {}))
+	assert.Equal(t, ErrShutdown, e.Submit("key", func(ctx context.Context) {}, time.Millisecond))
+	assert.Equal(t, 0, e.Pending("key"))
+	assert.Equal(t, 0, e.KeyNum())
+}
@@ -0,0 +1,170 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+)
+
+// Mutex is a mutual exclusion lock which supports TryLock and context based locking
+type Mutex struct {
+	locked bool
+	mu     sync.Mutex
+	cond   *TimeoutCond
+}
+
+// NewMutex creates a new unlocked Mutex
+func NewMutex() *Mutex {
+	m := &Mutex{}
+	m.cond = NewTimeoutCond(&m.mu)
+	return m
+}
+
+// Lock locks m, blocks until the lock is available
+func (m *Mutex) Lock() {
+	_ = m.LockContext(context.Background())
+}
+
+// TryLock tries to lock m without blocking, return whether it succeeded
+func (m *Mutex) TryLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.locked {
+		return false
+	}
+	m.locked = true
+	return true
+}
+
+// LockContext locks m, blocks until the lock is available or ctx is done.
+// On failure, returns ctx.Err() and m is not locked.
+func (m *Mutex) LockContext(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.cond.WaitFor(ctx, func() bool { return !m.locked }); err != nil {
+		return err
+	}
+	m.locked = true
+	return nil
+}
+
+// Unlock unlocks m, it is a run-time error if m is not locked
+func (m *Mutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.locked {
+		panic("mutex: unlock of unlocked mutex")
+	}
+	m.locked = false
+	m.cond.Broadcast()
+}
+
+// RWMutex is a reader/writer mutual exclusion lock which supports TryLock and context based locking,
+// a blocked writer excludes new readers from acquiring the lock
+type RWMutex struct {
+	readers        int
+	writer         bool
+	writersWaiting int
+	mu             sync.Mutex
+	cond           *TimeoutCond
+}
+
+// NewRWMutex creates a new unlocked RWMutex
+func NewRWMutex() *RWMutex {
+	rw := &RWMutex{}
+	rw.cond = NewTimeoutCond(&rw.mu)
+	return rw
+}
+
+// Lock locks rw for writing, blocks until the lock is available
+func (rw *RWMutex) Lock() {
+	_ = rw.LockContext(context.Background())
+}
+
+// TryLock tries to lock rw for writing without blocking, return whether it succeeded
+func (rw *RWMutex) TryLock() bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.writer || rw.readers > 0 {
+		return false
+	}
+	rw.writer = true
+	return true
+}
+
+// LockContext locks rw for writing, blocks until the lock is available or ctx is done.
+// On failure, returns ctx.Err() and rw is not locked.
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.writersWaiting++
+	err := rw.cond.WaitFor(ctx, func() bool { return !rw.writer && rw.readers == 0 })
+	rw.writersWaiting--
+	if err != nil {
+		// readers may be waiting for this writer
+		rw.cond.Broadcast()
+		return err
+	}
+	rw.writer = true
+	return nil
+}
+
+// Unlock unlocks rw for writing, it is a run-time error if rw is not locked for writing
+func (rw *RWMutex) Unlock() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if !rw.writer {
+		panic("rwmutex: unlock of unlocked rwmutex")
+	}
+	rw.writer = false
+	rw.cond.Broadcast()
+}
+
+// RLock locks rw for reading, blocks until the lock is available
+func (rw *RWMutex) RLock() {
+	_ = rw.RLockContext(context.Background())
+}
+
+// TryRLock tries to lock rw for reading without blocking, return whether it succeeded
+func (rw *RWMutex) TryRLock() bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.writer || rw.writersWaiting > 0 {
+		return false
+	}
+	rw.readers++
+	return true
+}
+
+// RLockContext locks rw for reading, blocks until the lock is available or ctx is done.
+// On failure, returns ctx.Err() and rw is not locked.
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if err := rw.cond.WaitFor(ctx, func() bool { return !rw.writer && rw.writersWaiting == 0 }); err != nil {
+		return err
+	}
+	rw.readers++
+	return nil
+}
+
+// RUnlock undoes a single RLock call, it is a run-time error if rw is not locked for reading
+func (rw *RWMutex) RUnlock() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.readers <= 0 {
+		panic("rwmutex: runlock of unlocked rwmutex")
+	}
+	rw.readers--
+	if rw.readers == 0 {
+		rw.cond.Broadcast()
+	}
+}
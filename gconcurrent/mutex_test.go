@@ -0,0 +1,85 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutexLockContext(t *testing.T) {
+	m := NewMutex()
+	assert.True(t, m.TryLock())
+	assert.False(t, m.TryLock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.LockContext(ctx))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.Unlock()
+	}()
+	assert.Nil(t, m.LockContext(context.Background()))
+	m.Unlock()
+	assert.Panics(t, m.Unlock)
+}
+
+func TestMutexCounter(t *testing.T) {
+	m := NewMutex()
+	counter := 0
+	wait := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				m.Lock()
+				counter++
+				m.Unlock()
+			}
+		}()
+	}
+	wait.Wait()
+	assert.Equal(t, 2000, counter)
+}
+
+func TestRWMutex(t *testing.T) {
+	rw := NewRWMutex()
+	assert.True(t, rw.TryRLock())
+	assert.True(t, rw.TryRLock())
+	assert.False(t, rw.TryLock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, rw.LockContext(ctx))
+	// the canceled writer does not block readers
+	assert.True(t, rw.TryRLock())
+
+	locked := make(chan struct{})
+	go func() {
+		rw.Lock()
+		close(locked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// a waiting writer blocks new readers
+	assert.False(t, rw.TryRLock())
+
+	rw.RUnlock()
+	rw.RUnlock()
+	rw.RUnlock()
+	<-locked
+	assert.False(t, rw.TryRLock())
+
+	rctx, rcancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer rcancel()
+	assert.Equal(t, context.DeadlineExceeded, rw.RLockContext(rctx))
+
+	rw.Unlock()
+	rw.RLock()
+	rw.RUnlock()
+	assert.Panics(t, rw.RUnlock)
+	assert.Panics(t, rw.Unlock)
+}
@@ -0,0 +1,312 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrSkipItem could be returned by StageFunc to drop the item without failing the pipeline
+	ErrSkipItem = errors.New("skip item")
+	// ErrPoolTooSmall is returned by Pipeline.Wait if MaxWorkerNum of pool is less than
+	// the total concurrency of stages, which could deadlock the pipeline
+	ErrPoolTooSmall = errors.New("pool is too small for the concurrency of stages")
+)
+
+// StageFunc is a function will process a item of pipeline stage and return the output item
+type StageFunc func(ctx context.Context, in interface{}) (interface{}, error)
+
+// PipelineOption is the pipeline parameter
+type PipelineOption struct {
+	// Pool execute the items of all stages if it is set, otherwise start a goroutine for each item.
+	// The MaxWorkerNum of pool must not be less than the total concurrency of stages
+	Pool      WorkerPool `json:"-"`
+	PanicFunc PanicFunc  `json:"-"`
+}
+
+// StageOption is the pipeline stage parameter
+type StageOption struct {
+	Concurrency int  `json:"concurrency" yaml:"concurrency"`
+	BufferSize  int  `json:"buffer_size" yaml:"buffer_size"`
+	Ordered     bool `json:"ordered" yaml:"ordered"` // output items in the order of input
+}
+
+// StageStats is the statistics of pipeline stage
+type StageStats struct {
+	Name      string
+	InNum     int64
+	OutNum    int64
+	SkipNum   int64
+	ErrorNum  int64
+	ActiveNum int64
+	QueueLen  int
+	ExecTime  LatencyStats
+}
+
+type stageResult struct {
+	value interface{}
+	skip  bool
+}
+
+type stage struct {
+	name   string
+	f      StageFunc
+	option StageOption
+	sem    *Semaphore
+	out    chan interface{}
+
+	inNum     int64
+	outNum    int64
+	skipNum   int64
+	errorNum  int64
+	activeNum int64
+
+	statsMux sync.Mutex
+	execTime histogram
+}
+
+// Pipeline is a multi-stage processing, each stage has its own concurrency and bounded buffer,
+// the first error of any stage cancels the pipeline, and is returned by Wait
+type Pipeline struct {
+	option PipelineOption
+	stages []*stage
+	group  *Group
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewPipeline creates a empty Pipeline with the given option
+func NewPipeline(opt ...PipelineOption) *Pipeline {
+	p := &Pipeline{}
+	if len(opt) >= 1 {
+		p.option = opt[0]
+	}
+	return p
+}
+
+// AddStage append a stage to the pipeline, it must be called before Run
+// default parameters:
+//   concurrency: 1
+//   bufferSize: 0
+func (p *Pipeline) AddStage(name string, f StageFunc, opt ...StageOption) *Pipeline {
+	s := &stage{
+		name:   name,
+		f:      f,
+		option: StageOption{Concurrency: 1},
+	}
+	if len(opt) >= 1 {
+		s.option = opt[0]
+	}
+	if s.option.Concurrency <= 0 {
+		s.option.Concurrency = 1
+	}
+	if s.option.BufferSize < 0 {
+		s.option.BufferSize = 0
+	}
+	s.sem = NewSemaphore(int64(s.option.Concurrency))
+	s.out = make(chan interface{}, s.option.BufferSize)
+
+	p.stages = append(p.stages, s)
+	return p
+}
+
+// Run starts the pipeline which reads items from in, and return the output channel
+// of the last stage. The output channel is closed when in is closed and all items are
+// processed, or the pipeline is canceled by ctx or a error. Run could be called only once.
+// If the pool is too small, the output channel is closed at once and Wait returns ErrPoolTooSmall
+func (p *Pipeline) Run(ctx context.Context, in <-chan interface{}) <-chan interface{} {
+	group, gctx := NewGroup(ctx, GroupOption{Pool: p.option.Pool, PanicFunc: p.option.PanicFunc})
+	p.group = group
+	p.ctx = ctx
+
+	// the upstream items wait in emit for the downstream ones, so all stages must run at the same time
+	if p.option.Pool != nil {
+		concurrency := 0
+		for _, s := range p.stages {
+			concurrency += s.option.Concurrency
+		}
+		if concurrency > p.option.Pool.Option().MaxWorkerNum {
+			group.setError(ErrPoolTooSmall)
+			out := make(chan interface{})
+			close(out)
+			return out
+		}
+	}
+
+	out := in
+	for _, s := range p.stages {
+		out = p.runStage(gctx, s, out)
+	}
+	return out
+}
+
+// Wait blocks until all stages have finished, then returns the first error,
+// or the error of ctx if the pipeline is canceled by ctx
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	if err := p.group.Wait(); err != nil {
+		return err
+	}
+	return p.ctx.Err()
+}
+
+// Stats return the statistics of all stages in order
+func (p *Pipeline) Stats() []StageStats {
+	stats := make([]StageStats, 0, len(p.stages))
+	for _, s := range p.stages {
+		stats = append(stats, s.stats())
+	}
+	return stats
+}
+
+func (p *Pipeline) runStage(ctx context.Context, s *stage, in <-chan interface{}) <-chan interface{} {
+	var pending chan chan stageResult
+	if s.option.Ordered {
+		// results are emitted in the order of slots, the number of slots is bounded
+		// by the concurrency and buffer size, so it also applies backpressure
+		pending = make(chan chan stageResult, s.option.Concurrency+s.option.BufferSize)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer close(s.out)
+			s.emitOrdered(ctx, pending)
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		inflight := &sync.WaitGroup{}
+		p.dispatch(ctx, s, in, pending, inflight)
+		inflight.Wait()
+		if pending != nil {
+			close(pending)
+		} else {
+			close(s.out)
+		}
+	}()
+
+	return s.out
+}
+
+// dispatch reads items from in and process them with the limited concurrency
+func (p *Pipeline) dispatch(ctx context.Context, s *stage, in <-chan interface{},
+	pending chan chan stageResult, inflight *sync.WaitGroup) {
+	for {
+		var item interface{}
+		var ok bool
+		select {
+		case item, ok = <-in:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.sem.Acquire(ctx, 1); err != nil {
+			return
+		}
+		atomic.AddInt64(&s.inNum, 1)
+
+		var slot chan stageResult
+		if pending != nil {
+			slot = make(chan stageResult, 1)
+			select {
+			case pending <- slot:
+			case <-ctx.Done():
+				s.sem.Release(1)
+				return
+			}
+		}
+
+		inflight.Add(1)
+		p.group.Go(func(ctx context.Context) error {
+			defer inflight.Done()
+			defer s.sem.Release(1)
+			return s.process(ctx, item, slot)
+		})
+	}
+}
+
+func (s *stage) process(ctx context.Context, item interface{}, slot chan stageResult) error {
+	result := stageResult{skip: true}
+	if slot != nil {
+		// the emitter must not wait for a failed item
+		defer func() { slot <- result }()
+	}
+
+	atomic.AddInt64(&s.activeNum, 1)
+	start := time.Now()
+	defer func() {
+		atomic.AddInt64(&s.activeNum, -1)
+		s.statsMux.Lock()
+		s.execTime.add(time.Since(start))
+		s.statsMux.Unlock()
+	}()
+
+	v, err := s.f(ctx, item)
+	if err == ErrSkipItem {
+		atomic.AddInt64(&s.skipNum, 1)
+		return nil
+	}
+	if err != nil {
+		atomic.AddInt64(&s.errorNum, 1)
+		return err
+	}
+
+	if slot != nil {
+		result = stageResult{value: v}
+		return nil
+	}
+	return s.emit(ctx, v)
+}
+
+// emitOrdered emits the results in the order of slots
+func (s *stage) emitOrdered(ctx context.Context, pending chan chan stageResult) {
+	for slot := range pending {
+		var result stageResult
+		select {
+		case result = <-slot:
+		case <-ctx.Done():
+			return
+		}
+
+		if result.skip {
+			continue
+		}
+		if s.emit(ctx, result.value) != nil {
+			return
+		}
+	}
+}
+
+func (s *stage) emit(ctx context.Context, v interface{}) error {
+	select {
+	case s.out <- v:
+		atomic.AddInt64(&s.outNum, 1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *stage) stats() StageStats {
+	s.statsMux.Lock()
+	execTime := s.execTime.stats()
+	s.statsMux.Unlock()
+
+	return StageStats{
+		Name:      s.name,
+		InNum:     atomic.LoadInt64(&s.inNum),
+		OutNum:    atomic.LoadInt64(&s.outNum),
+		SkipNum:   atomic.LoadInt64(&s.skipNum),
+		ErrorNum:  atomic.LoadInt64(&s.errorNum),
+		ActiveNum: atomic.LoadInt64(&s.activeNum),
+		QueueLen:  len(s.out),
+		ExecTime:  execTime,
+	}
+}
@@ -0,0 +1,131 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func source(n int) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func TestPipelineOrdered(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 4, MaxWorkerNum: 16, QueueSize: 100})
+	p := NewPipeline(PipelineOption{Pool: w}).
+		AddStage("decode", func(ctx context.Context, in interface{}) (interface{}, error) {
+			time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+			return in.(int) * 2, nil
+		}, StageOption{Concurrency: 4, BufferSize: 2, Ordered: true}).
+		AddStage("filter", func(ctx context.Context, in interface{}) (interface{}, error) {
+			if in.(int)%4 == 0 {
+				return nil, ErrSkipItem
+			}
+			return in, nil
+		}, StageOption{Concurrency: 2, Ordered: true}).
+		AddStage("write", func(ctx context.Context, in interface{}) (interface{}, error) {
+			time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+			return in.(int) + 1, nil
+		}, StageOption{Concurrency: 8, BufferSize: 4, Ordered: true})
+
+	out := p.Run(context.Background(), source(100))
+	expect := 3
+	for v := range out {
+		assert.Equal(t, expect, v)
+		expect += 4
+	}
+	assert.Equal(t, 203, expect)
+	assert.Nil(t, p.Wait())
+
+	stats := p.Stats()
+	assert.Equal(t, 3, len(stats))
+	assert.Equal(t, "decode", stats[0].Name)
+	assert.Equal(t, int64(100), stats[0].InNum)
+	assert.Equal(t, int64(100), stats[0].OutNum)
+	assert.Equal(t, int64(50), stats[1].SkipNum)
+	assert.Equal(t, int64(50), stats[2].OutNum)
+	assert.Equal(t, int64(100), stats[0].ExecTime.Count)
+	w.Shutdown(context.Background())
+}
+
+func TestPipelineUnordered(t *testing.T) {
+	p := NewPipeline().
+		AddStage("square", func(ctx context.Context, in interface{}) (interface{}, error) {
+			return in.(int) * in.(int), nil
+		}, StageOption{Concurrency: 4})
+
+	sum := 0
+	for v := range p.Run(context.Background(), source(10)) {
+		sum += v.(int)
+	}
+	assert.Equal(t, 285, sum)
+	assert.Nil(t, p.Wait())
+}
+
+func TestPipelineError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	p := NewPipeline().
+		AddStage("fail", func(ctx context.Context, in interface{}) (interface{}, error) {
+			if in.(int) == 10 {
+				return nil, errStage
+			}
+			return in, nil
+		}, StageOption{Concurrency: 2, Ordered: true}).
+		AddStage("slow", func(ctx context.Context, in interface{}) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return in, nil
+		})
+
+	count := 0
+	for range p.Run(context.Background(), source(1000)) {
+		count++
+	}
+	assert.True(t, count < 1000)
+	assert.Equal(t, errStage, p.Wait())
+	assert.Equal(t, int64(1), p.Stats()[0].ErrorNum)
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPipeline().
+		AddStage("block", func(ctx context.Context, in interface{}) (interface{}, error) {
+			return in, nil
+		}, StageOption{BufferSize: 1})
+
+	out := p.Run(ctx, source(100))
+	<-out
+	// stop reading output, the pipeline is blocked by backpressure until canceled
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, p.Stats()[0].InNum < 10)
+	cancel()
+
+	for range out {
+	}
+	assert.Equal(t, context.Canceled, p.Wait())
+}
+
+func TestPipelinePoolTooSmall(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 2, QueueSize: 10})
+	defer w.Shutdown(context.Background())
+	identity := func(ctx context.Context, in interface{}) (interface{}, error) { return in, nil }
+	p := NewPipeline(PipelineOption{Pool: w}).
+		AddStage("first", identity, StageOption{Concurrency: 2}).
+		AddStage("second", identity, StageOption{Concurrency: 1})
+
+	for range p.Run(context.Background(), source(10)) {
+		t.Fatal("Should not output any item")
+	}
+	assert.Equal(t, ErrPoolTooSmall, p.Wait())
+	assert.Equal(t, int64(0), p.Stats()[0].InNum)
+}
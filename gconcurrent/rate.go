@@ -0,0 +1,76 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// tokenBucket is a token bucket which throttles the dispatching of jobs
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  gtime.Clock
+}
+
+func newTokenBucket(rate float64, burst int, clock gtime.Clock) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+// reserve take a token and return the duration to wait before the token is available
+func (tb *tokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// cancel give back a reserved token
+func (tb *tokenBucket) cancel() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.tokens++
+}
+
+// wait blocks until a token is available or ctx is done
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	delay := tb.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := tb.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		tb.cancel()
+		return ctx.Err()
+	}
+}
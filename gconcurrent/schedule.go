@@ -0,0 +1,144 @@
+package gconcurrent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// SubmitAfter add the job to queue after the delay by the timer wheel, the id of timer is returned
+func (w *workerPool) SubmitAfter(jf JobFunc, delay time.Duration) (string, error) {
+	return w.schedule(jf, delay, 1)
+}
+
+// SubmitEvery add the job to queue every interval until it is canceled or the pool is shutdown
+func (w *workerPool) SubmitEvery(jf JobFunc, interval time.Duration) (string, error) {
+	return w.schedule(jf, interval, 0)
+}
+
+// CancelScheduled cancel the delayed or periodic job, the job added to queue already is not affected
+func (w *workerPool) CancelScheduled(timerID string) error {
+	w.mux.Lock()
+	timer, ok := w.scheduled[timerID]
+	delete(w.scheduled, timerID)
+	w.mux.Unlock()
+
+	if !ok {
+		return errors.New("scheduled job not found")
+	}
+	timer.Stop()
+	return nil
+}
+
+func (w *workerPool) schedule(jf JobFunc, interval time.Duration, times int) (string, error) {
+	if jf == nil {
+		return "", errors.New("job function is empty")
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.queue == nil {
+		return "", ErrShutdown
+	}
+
+	wheel := w.timerWheel()
+	// the timer id is only known after scheduled, so the callback must wait for it
+	idCh := make(chan string, 1)
+	timer, err := wheel.AfterFunc(interval, times, func() {
+		id := <-idCh
+		idCh <- id
+		w.fire(id, jf, times == 1)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	tid := timer.ID()
+	idCh <- tid
+	w.scheduled[tid] = timer
+	return tid, nil
+}
+
+// fire add the scheduled job to queue, it blocks until the queue has free space
+func (w *workerPool) fire(tid string, jf JobFunc, once bool) {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+
+	w.mux.Lock()
+	_, ok := w.scheduled[tid]
+	if once {
+		delete(w.scheduled, tid)
+	}
+	queue := w.queue
+	w.mux.Unlock()
+
+	if !ok || queue == nil {
+		return
+	}
+
+	w.incWorker()
+	queue <- w.toItem(jf)
+}
+
+// timerWheel return the timer wheel which drives the scheduled jobs, must hold lock
+func (w *workerPool) timerWheel() *gtime.TimerWheel {
+	if w.wheel != nil {
+		return w.wheel
+	}
+
+	if w.option.TimerWheel != nil {
+		w.wheel = w.option.TimerWheel
+	} else {
+		w.wheel = gtime.NewTimerWheel(gtime.TwOption{
+			TickDuration: 10 * time.Millisecond,
+			WheelCount:   512,
+			Clock:        w.option.Clock,
+		})
+		w.wheel.Start()
+		w.ownWheel = true
+	}
+	return w.wheel
+}
+
+// stopScheduled cancel all delayed and periodic jobs, and stop the timer wheel if it is created by pool
+func (w *workerPool) stopScheduled() {
+	w.mux.Lock()
+	scheduled := w.scheduled
+	w.scheduled = make(map[string]*gtime.Timer)
+	wheel, ownWheel := w.wheel, w.ownWheel
+	w.wheel, w.ownWheel = nil, false
+	w.mux.Unlock()
+
+	if wheel == nil {
+		return
+	}
+	for _, timer := range scheduled {
+		timer.Stop()
+	}
+	if ownWheel {
+		wheel.Stop()
+	}
+}
+
+// CronExecutor adapts the pool to gtime.Executor, so the jobs of gtime.Cron or the callbacks
+// of gtime.TimerWheel (TwOption.Executor) run on the pool.
+// It is also a gtime.TryExecutor, so gtime.Cron knows the jobs rejected after the pool is shutdown
+func CronExecutor(pool WorkerPool) gtime.Executor {
+	return cronExecutor{pool: pool}
+}
+
+type cronExecutor struct {
+	pool WorkerPool
+}
+
+// Execute implements gtime.Executor
+func (e cronExecutor) Execute(f func()) {
+	e.pool.Execute(func(context.Context) { f() })
+}
+
+// TryExecute implements gtime.TryExecutor
+func (e cronExecutor) TryExecute(f func()) error {
+	return e.pool.TryExecute(func(context.Context) { f() })
+}
@@ -0,0 +1,67 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore is a weighted semaphore which supports context based acquiring
+type Semaphore struct {
+	size int64
+	cur  int64
+	mu   sync.Mutex
+	cond *TimeoutCond
+}
+
+// NewSemaphore creates a new weighted semaphore with the given maximum combined weight
+func NewSemaphore(size int64) *Semaphore {
+	s := &Semaphore{size: size}
+	s.cond = NewTimeoutCond(&s.mu)
+	return s
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources
+// are available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() and leaves the semaphore unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.cond.WaitFor(ctx, func() bool { return s.cur+n <= s.size }); err != nil {
+		return err
+	}
+	s.cur += n
+	return nil
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking.
+// On success, returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cur+n > s.size {
+		return false
+	}
+	s.cur += n
+	return true
+}
+
+// Release releases the semaphore with a weight of n.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore: released more than held")
+	}
+	s.cond.Broadcast()
+}
+
+// Available return the weight which could be acquired without blocking
+func (s *Semaphore) Available() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size - s.cur
+}
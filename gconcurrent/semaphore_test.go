@@ -0,0 +1,55 @@
+package gconcurrent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphoreAcquire(t *testing.T) {
+	s := NewSemaphore(10)
+	assert.Nil(t, s.Acquire(context.Background(), 6))
+	assert.True(t, s.TryAcquire(4))
+	assert.False(t, s.TryAcquire(1))
+	assert.Equal(t, int64(0), s.Available())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Acquire(ctx, 1))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Release(6)
+	}()
+	assert.Nil(t, s.Acquire(context.Background(), 5))
+	assert.Equal(t, int64(1), s.Available())
+
+	assert.Panics(t, func() { s.Release(100) })
+}
+
+func TestSemaphoreContention(t *testing.T) {
+	s := NewSemaphore(3)
+	var running, maxRunning int32
+	wait := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+		go func(n int64) {
+			defer wait.Done()
+			assert.Nil(t, s.Acquire(context.Background(), n))
+			cur := atomic.AddInt32(&running, int32(n))
+			if cur > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, cur)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -int32(n))
+			s.Release(n)
+		}(int64(i%3 + 1))
+	}
+	wait.Wait()
+	assert.True(t, maxRunning <= 3)
+	assert.Equal(t, int64(3), s.Available())
+}
@@ -8,10 +8,13 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/xtfly/gokits/gtime"
 )
 
 var (
-	ErrTimeout = errors.New("add to job queue timeout")
+	ErrTimeout  = errors.New("add to job queue timeout")
+	ErrShutdown = errors.New("worker pool is shutdown")
 )
 
 // JobFunc is a job function will execute by worker goroutine
@@ -20,19 +23,37 @@ type JobFunc func(context.Context)
 // PanicFunc is a function will process panic which throw in worker function
 type PanicFunc func(recovered interface{}, funcName string)
 
+// StatsFunc is a function will receive the statistics of worker pool periodically
+type StatsFunc func(stats WpStats)
+
 type queueItem struct {
-	jobFunc  JobFunc
-	funcName string
+	jobFunc   JobFunc
+	funcName  string
+	enqueueAt time.Time
 }
 
 type WorkerPool interface {
-	// Execute add worker function to queue to wait for executing by worker goroutine
+	// Execute add worker function to queue to wait for executing by worker goroutine,
+	// it blocks until the queue has free space, the function is dropped and counted
+	// in SubmitFailNum after the pool is shutdown
 	Execute(f JobFunc)
 
+	// TryExecute is the same as Execute, but return ErrShutdown after the pool is shutdown
+	TryExecute(f JobFunc) error
+
 	// Execute summit worker function to queue  with a timeout timer,
 	// if add queue success it will wait for executing by worker goroutine
 	Submit(f JobFunc, timeout time.Duration) error
 
+	// SubmitAfter add worker function to queue after the delay, return the id of timer
+	SubmitAfter(f JobFunc, delay time.Duration) (string, error)
+
+	// SubmitEvery add worker function to queue every interval, return the id of timer
+	SubmitEvery(f JobFunc, interval time.Duration) (string, error)
+
+	// CancelScheduled cancel the delayed or periodic job with the id of timer
+	CancelScheduled(timerID string) error
+
 	// Stop cancel all goroutines started by this pool and wait
 	Shutdown(ctx context.Context)
 
@@ -48,6 +69,16 @@ type workerPool struct {
 	option WpOption
 	stats  WpStats
 
+	statsMux  sync.Mutex // guard the job results of stats and histograms
+	queueWait histogram
+	execTime  histogram
+
+	bucket    *tokenBucket
+	wheel     *gtime.TimerWheel
+	ownWheel  bool
+	scheduled map[string]*gtime.Timer
+	closeMux  sync.RWMutex // guard closing queue from the scheduled jobs
+
 	mux    sync.Mutex
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -55,19 +86,35 @@ type workerPool struct {
 
 // WpOption is the worker pool parameter
 type WpOption struct {
-	InitWorkerNum int       `json:"init_worker_num" yaml:"init_worker_num"`
-	MaxWorkerNum  int       `json:"max_worker_num" yaml:"max_worker_num"`
-	QueueSize     int       `json:"queue_size" yaml:"queue_size"`
-	PanicFunc     PanicFunc `json:"-"`
+	InitWorkerNum int           `json:"init_worker_num" yaml:"init_worker_num"`
+	MaxWorkerNum  int           `json:"max_worker_num" yaml:"max_worker_num"`
+	QueueSize     int           `json:"queue_size" yaml:"queue_size"`
+	StatsInterval time.Duration `json:"stats_interval" yaml:"stats_interval"`
+	// Rate is the max number of jobs dispatched to workers per second, zero indicates no limit.
+	// The worker waits for the rate after dequeuing a job, so the waiting is counted in QueueWait
+	Rate float64 `json:"rate" yaml:"rate"`
+	// Burst is the max number of jobs dispatched at once when Rate is set
+	Burst int `json:"burst" yaml:"burst"`
+
+	PanicFunc  PanicFunc         `json:"-"`
+	StatsFunc  StatsFunc         `json:"-"`
+	TimerWheel *gtime.TimerWheel `json:"-"` // drive the scheduled jobs, create one if not set
+	// Clock drives the Rate, the statistics, the timeout of Submit and the timer wheel created by pool,
+	// default gtime.RealClock
+	Clock gtime.Clock `json:"-"`
 }
 
 // WpStats is the statistics of worker pool
 type WpStats struct {
 	ActiveNum     int32
 	WorkerNum     int32
+	QueueLen      int32
 	ExecuteNum    int32
+	CompleteNum   int32
 	SubmitFailNum int32
 	PanicNum      int32
+	QueueWait     LatencyStats // time from adding to queue to starting execution, include waiting for Rate
+	ExecTime      LatencyStats // time of job function execution, include panicked jobs
 }
 
 // NewWorkerPool creates a instance of WorkerPool with given option
@@ -75,6 +122,9 @@ type WpStats struct {
 //   queueSize: 100
 //   initWorkerNum: 2
 //   maxWorkerNum: 50
+// if StatsInterval and StatsFunc are set, StatsFunc will be called with the
+// statistics every StatsInterval until the pool is shutdown
+// if Rate is set, the jobs is dispatched to workers by a token bucket with size of Burst
 func NewWorkerPool(opt ...WpOption) WorkerPool {
 	ctx, cancel := context.WithCancel(context.TODO())
 	wp := &workerPool{
@@ -83,8 +133,9 @@ func NewWorkerPool(opt ...WpOption) WorkerPool {
 			MaxWorkerNum:  50,
 			QueueSize:     100,
 		},
-		ctx:    ctx,
-		cancel: cancel,
+		ctx:       ctx,
+		cancel:    cancel,
+		scheduled: make(map[string]*gtime.Timer),
 	}
 
 	if len(opt) >= 1 {
@@ -92,14 +143,55 @@ func NewWorkerPool(opt ...WpOption) WorkerPool {
 		wp.option = cfg
 	}
 
+	if wp.option.Clock == nil {
+		wp.option.Clock = gtime.RealClock
+	}
+	if wp.option.Rate > 0 {
+		wp.bucket = newTokenBucket(wp.option.Rate, wp.option.Burst, wp.option.Clock)
+	}
+
 	wp.queue = make(chan *queueItem, wp.option.QueueSize)
 	wp.run(wp.option.InitWorkerNum)
 
+	if wp.option.StatsInterval > 0 && wp.option.StatsFunc != nil {
+		go wp.exportStats()
+	}
+
 	return wp
 }
 
 func (w *workerPool) Stats() WpStats {
-	return w.stats
+	w.mux.Lock()
+	queueLen := int32(len(w.queue))
+	w.mux.Unlock()
+
+	w.statsMux.Lock()
+	defer w.statsMux.Unlock()
+
+	return WpStats{
+		ActiveNum:     atomic.LoadInt32(&w.stats.ActiveNum),
+		WorkerNum:     atomic.LoadInt32(&w.stats.WorkerNum),
+		QueueLen:      queueLen,
+		ExecuteNum:    atomic.LoadInt32(&w.stats.ExecuteNum),
+		CompleteNum:   atomic.LoadInt32(&w.stats.CompleteNum),
+		SubmitFailNum: atomic.LoadInt32(&w.stats.SubmitFailNum),
+		PanicNum:      atomic.LoadInt32(&w.stats.PanicNum),
+		QueueWait:     w.queueWait.stats(),
+		ExecTime:      w.execTime.stats(),
+	}
+}
+
+func (w *workerPool) exportStats() {
+	ticker := w.option.Clock.NewTicker(w.option.StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			w.option.StatsFunc(w.Stats())
+		case <-w.ctx.Done():
+			return
+		}
+	}
 }
 
 func (w *workerPool) Option() WpOption {
@@ -112,33 +204,43 @@ func (w *workerPool) toItem(jf JobFunc) *queueItem {
 	funcName := f.Name()
 
 	return &queueItem{
-		jobFunc:  jf,
-		funcName: funcName,
+		jobFunc:   jf,
+		funcName:  funcName,
+		enqueueAt: w.option.Clock.Now(),
 	}
 }
 
 func (w *workerPool) run(incNum int) {
 	for idx := 0; idx < incNum; idx++ {
 		atomic.AddInt32(&w.stats.WorkerNum, 1)
+		queue := w.queue
 		go func() {
-			for it := range w.queue {
+			for it := range queue {
+				w.throttle()
 				w.executeOne(it)
 			}
 		}()
 	}
 }
 
+// throttle wait for a token if the dispatching rate is limited,
+// the remaining jobs are dispatched without waiting after shutdown
+func (w *workerPool) throttle() {
+	if w.bucket != nil {
+		_ = w.bucket.wait(w.ctx)
+	}
+}
+
 func (w *workerPool) executeOne(it *queueItem) {
 	atomic.AddInt32(&w.stats.ActiveNum, 1)
+	start := w.option.Clock.Now()
 
 	defer func() {
 		atomic.AddInt32(&w.stats.ActiveNum, -1)
 		recovered := recover()
-		if recovered != nil {
-			atomic.AddInt32(&w.stats.PanicNum, 1)
-			if w.option.PanicFunc != nil {
-				w.option.PanicFunc(recovered, it.funcName)
-			}
+		w.record(it, start, recovered != nil)
+		if recovered != nil && w.option.PanicFunc != nil {
+			w.option.PanicFunc(recovered, it.funcName)
 		}
 	}()
 
@@ -146,6 +248,22 @@ func (w *workerPool) executeOne(it *queueItem) {
 	it.jobFunc(w.ctx)
 }
 
+// record the result and latencies of a executed job
+func (w *workerPool) record(it *queueItem, start time.Time, panicked bool) {
+	end := w.option.Clock.Now()
+
+	w.statsMux.Lock()
+	defer w.statsMux.Unlock()
+
+	if panicked {
+		atomic.AddInt32(&w.stats.PanicNum, 1)
+	} else {
+		atomic.AddInt32(&w.stats.CompleteNum, 1)
+	}
+	w.queueWait.add(start.Sub(it.enqueueAt))
+	w.execTime.add(end.Sub(start))
+}
+
 func (w *workerPool) incWorker() {
 	activeNum := int(atomic.LoadInt32(&w.stats.ActiveNum))
 	workerNum := int(atomic.LoadInt32(&w.stats.WorkerNum))
@@ -165,24 +283,62 @@ func (w *workerPool) incWorker() {
 }
 
 func (w *workerPool) Execute(jf JobFunc) {
+	if w.TryExecute(jf) != nil {
+		atomic.AddInt32(&w.stats.SubmitFailNum, 1)
+	}
+}
+
+func (w *workerPool) TryExecute(jf JobFunc) error {
+	// hold the read lock while sending, so Shutdown can not close the queue under it
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+
+	queue := w.activeQueue()
+	if queue == nil {
+		return ErrShutdown
+	}
 	w.incWorker()
-	w.queue <- w.toItem(jf)
+	queue <- w.toItem(jf)
+	return nil
 }
 
 func (w *workerPool) Submit(jf JobFunc, timeout time.Duration) error {
+	w.closeMux.RLock()
+	defer w.closeMux.RUnlock()
+
+	queue := w.activeQueue()
+	if queue == nil {
+		return ErrShutdown
+	}
 	w.incWorker()
+
+	timer := w.option.Clock.NewTimer(timeout)
+	defer timer.Stop()
 	select {
-	case <-time.NewTimer(timeout).C:
+	case <-timer.C():
 		atomic.AddInt32(&w.stats.SubmitFailNum, 1)
 		return ErrTimeout
-	case w.queue <- w.toItem(jf):
+	case queue <- w.toItem(jf):
 		return nil
 	}
 }
 
+// activeQueue return the job queue, nil if the pool is shutdown
+func (w *workerPool) activeQueue() chan *queueItem {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.queue
+}
+
 func (w *workerPool) Shutdown(ctx context.Context) {
+	// wait for the scheduled jobs which are adding to queue
+	w.closeMux.Lock()
+	w.mux.Lock()
 	close(w.queue)
 	w.queue = nil
+	w.mux.Unlock()
+	w.closeMux.Unlock()
+	w.stopScheduled()
 	w.cancel()
 
 	for {
@@ -3,6 +3,9 @@ package gconcurrent
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/xtfly/gokits/gtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -85,7 +88,249 @@ func TestWorkerSubmitTimeout(t *testing.T) {
 	}, 5*time.Millisecond)
 	assert.Equal(t, ErrTimeout, err)
 
+	<-evt
+	<-evt
+	w.Shutdown(context.Background())
+
+}
+
+func TestWorkerExecuteShutdown(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 2, MaxWorkerNum: 4, QueueSize: 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var err error
+				if i%2 == 0 {
+					err = w.TryExecute(func(ctx context.Context) {})
+				} else {
+					err = w.Submit(func(ctx context.Context) {}, time.Second)
+				}
+				if err == ErrShutdown {
+					return
+				}
+			}
+		}(i)
+	}
+
+	w.Shutdown(context.Background())
+	wg.Wait()
+	assert.Equal(t, ErrShutdown, w.TryExecute(func(ctx context.Context) {}))
+	failed := w.Stats().SubmitFailNum
+	w.Execute(func(ctx context.Context) {})
+	assert.Equal(t, failed+1, w.Stats().SubmitFailNum)
+	assert.Equal(t, ErrShutdown, w.Submit(func(ctx context.Context) {}, time.Millisecond))
+}
+
+func TestWorkerStats(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 2, MaxWorkerNum: 2, QueueSize: 10})
+	evt := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		w.Execute(func(ctx context.Context) {
+			<-evt
+			time.Sleep(5 * time.Millisecond)
+		})
+	}
+	w.Execute(func(ctx context.Context) {
+		panic("stats panic")
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	stats := w.Stats()
+	assert.Equal(t, int32(2), stats.ActiveNum)
+	assert.Equal(t, int32(3), stats.QueueLen)
+
 	close(evt)
+	time.Sleep(50 * time.Millisecond)
+	stats = w.Stats()
+	assert.Equal(t, int32(0), stats.QueueLen)
+	assert.Equal(t, int32(5), stats.ExecuteNum)
+	assert.Equal(t, int32(4), stats.CompleteNum)
+	assert.Equal(t, int32(1), stats.PanicNum)
+	assert.Equal(t, int64(5), stats.ExecTime.Count)
+	assert.Equal(t, int64(5), stats.QueueWait.Count)
+	assert.True(t, stats.ExecTime.P50 >= 5*time.Millisecond)
+	assert.True(t, stats.ExecTime.P99 <= stats.ExecTime.Max)
+	assert.True(t, stats.QueueWait.Max >= 20*time.Millisecond)
+
+	w.Shutdown(context.Background())
+}
+
+func TestWorkerStatsFunc(t *testing.T) {
+	ch := make(chan WpStats, 10)
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 1, QueueSize: 10,
+		StatsInterval: 10 * time.Millisecond,
+		StatsFunc: func(stats WpStats) {
+			select {
+			case ch <- stats:
+			default:
+			}
+		}})
+
+	w.Execute(func(ctx context.Context) {})
+	time.Sleep(30 * time.Millisecond)
+	stats := <-ch
+	assert.Equal(t, int32(1), stats.WorkerNum)
+	w.Shutdown(context.Background())
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := histogram{}
+	assert.Equal(t, LatencyStats{}, h.stats())
+
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	stats := h.stats()
+	assert.Equal(t, int64(100), stats.Count)
+	assert.Equal(t, time.Millisecond, stats.Min)
+	assert.Equal(t, 100*time.Millisecond, stats.Max)
+	assert.Equal(t, 50500*time.Microsecond, stats.Mean)
+	// percentiles are the upper bounds of exponential buckets
+	assert.True(t, stats.P50 >= 50*time.Millisecond && stats.P50 <= 100*time.Millisecond)
+	assert.True(t, stats.P90 >= 90*time.Millisecond && stats.P90 <= 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, stats.P99)
+}
+
+func TestWorkerRateLimit(t *testing.T) {
+	w := NewWorkerPool(WpOption{InitWorkerNum: 4, MaxWorkerNum: 4, QueueSize: 100, Rate: 100, Burst: 5})
+	wait := sync.WaitGroup{}
+
+	begin := time.Now()
+	for i := 0; i < 15; i++ {
+		wait.Add(1)
+		w.Execute(func(ctx context.Context) {
+			wait.Done()
+		})
+	}
+	wait.Wait()
+
+	// 5 jobs dispatched at once by burst, the others need 10 tokens at 100/s
+	elapsed := time.Since(begin)
+	assert.True(t, elapsed >= 90*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < time.Second, "elapsed %v", elapsed)
+	w.Shutdown(context.Background())
+}
+
+func TestWorkerClock(t *testing.T) {
+	clock := gtime.NewFakeClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := NewWorkerPool(WpOption{InitWorkerNum: 1, MaxWorkerNum: 1, QueueSize: 10, Rate: 10, Burst: 1, Clock: clock})
+	done := make(chan struct{}, 2)
+
+	for i := 0; i < 2; i++ {
+		w.Execute(func(ctx context.Context) {
+			done <- struct{}{}
+		})
+	}
+	<-done
+
+	// the second job waits for a token on the clock
+	clock.BlockUntil(1)
+	assert.Equal(t, 0, len(done))
+	clock.Advance(100 * time.Millisecond)
+	<-done
+
+	w.Shutdown(context.Background())
+	stats := w.Stats()
+	for stats.CompleteNum < 2 {
+		time.Sleep(time.Millisecond)
+		stats = w.Stats()
+	}
+	assert.Equal(t, time.Duration(0), stats.QueueWait.Min)
+	assert.Equal(t, 100*time.Millisecond, stats.QueueWait.Max)
+}
+
+func TestWorkerSubmitAfter(t *testing.T) {
+	w := NewWorkerPool()
+	evt := make(chan time.Time, 1)
+
+	begin := time.Now()
+	_, err := w.SubmitAfter(func(ctx context.Context) {
+		evt <- time.Now()
+	}, 50*time.Millisecond)
+	assert.Nil(t, err)
+
+	fired := <-evt
+	assert.True(t, fired.Sub(begin) >= 50*time.Millisecond)
+
+	tid, err := w.SubmitAfter(func(ctx context.Context) {
+		evt <- time.Now()
+	}, 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, w.CancelScheduled(tid))
+	assert.NotNil(t, w.CancelScheduled(tid))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, len(evt))
 	w.Shutdown(context.Background())
 
+	_, err = w.SubmitAfter(func(ctx context.Context) {}, time.Millisecond)
+	assert.Equal(t, ErrShutdown, err)
+}
+
+func TestWorkerSubmitEvery(t *testing.T) {
+	w := NewWorkerPool()
+	var fired int32
+
+	tid, err := w.SubmitEvery(func(ctx context.Context) {
+		atomic.AddInt32(&fired, 1)
+	}, 20*time.Millisecond)
+	assert.Nil(t, err)
+
+	time.Sleep(110 * time.Millisecond)
+	assert.Nil(t, w.CancelScheduled(tid))
+	n := atomic.LoadInt32(&fired)
+	assert.True(t, n >= 3 && n <= 6, "fired %v times", n)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&fired))
+	w.Shutdown(context.Background())
+}
+
+func TestWorkerCronExecutor(t *testing.T) {
+	w := NewWorkerPool()
+	defer w.Shutdown(context.Background())
+
+	done := make(chan struct{})
+	c := gtime.NewCron(gtime.CronOption{Executor: CronExecutor(w)})
+	_, err := c.AddFunc("@every 10ms", func() {
+		select {
+		case done <- struct{}{}:
+		default:
+		}
+	})
+	assert.Nil(t, err)
+	c.Start()
+	defer c.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cron job should run on pool")
+	}
+}
+
+func TestWorkerCronExecutorShutdown(t *testing.T) {
+	w := NewWorkerPool()
+	w.Shutdown(context.Background())
+
+	clock := gtime.NewFakeClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	rejected := make(chan error, 2)
+	c := gtime.NewCron(gtime.CronOption{Executor: CronExecutor(w), Overlap: gtime.OverlapSkip, Clock: clock,
+		ErrorFunc: func(err error, entryID int) { rejected <- err }})
+	_, err := c.AddFunc("@every 1s", func() {})
+	assert.Nil(t, err)
+	c.Start()
+	defer c.Stop()
+
+	// the job is activated again after the rejected run
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		assert.Equal(t, ErrShutdown, <-rejected)
+	}
+	assert.Equal(t, 0, c.Entries()[0].Running)
 }
@@ -0,0 +1,49 @@
+package grate
+
+import (
+	"time"
+)
+
+// AIMDOption AIMD config.
+type AIMDOption struct {
+	LimitOption
+	BackoffRatio float64       `json:"backoff_ratio" yaml:"backoff_ratio"` // ratio to decrease limit on drop or timeout (default 0.9).
+	Timeout      time.Duration `json:"timeout" yaml:"timeout"`             // average rtt treats as overload (default 5s).
+}
+
+// AIMD is the concurrency limit of additive increase multiplicative decrease,
+// it increases the limit by one every window and decreases it by BackoffRatio on overload.
+type AIMD struct {
+	limitBase
+	option AIMDOption
+}
+
+// NewAIMD creates a AIMD concurrency limit.
+func NewAIMD(opt ...AIMDOption) *AIMD {
+	option := AIMDOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.BackoffRatio <= 0 || option.BackoffRatio >= 1 {
+		option.BackoffRatio = 0.9
+	}
+	if option.Timeout <= 0 {
+		option.Timeout = 5 * time.Second
+	}
+
+	a := &AIMD{option: option}
+	a.init(option.LimitOption, a)
+	return a
+}
+
+func (a *AIMD) update(s *sample, lastRTT int64, limit int64) float64 {
+	if s.Drop() || lastRTT > int64(a.option.Timeout) {
+		return float64(limit) * a.option.BackoffRatio
+	}
+
+	// do not increase the limit if it is not reached
+	if s.MaxInFlight()*2 < limit {
+		return float64(limit)
+	}
+	return float64(limit + 1)
+}
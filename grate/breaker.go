@@ -0,0 +1,289 @@
+package grate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+var (
+	// ErrBreakerOpen is returned by Breaker.Allow when the breaker is open.
+	ErrBreakerOpen = errors.New("circuit breaker is open")
+	// ErrTooManyProbes is returned by Breaker.Allow when the probes of half-open are exhausted.
+	ErrTooManyProbes = errors.New("too many probes in half-open state")
+)
+
+// State is the state of circuit breaker.
+type State int
+
+const (
+	// StateClosed state: the requests are allowed, and the results are recorded
+	StateClosed State = iota
+	// StateOpen state: the requests are rejected until OpenTimeout
+	StateOpen
+	// StateHalfOpen state: limited probes are allowed to check if downstream is recovered
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOption circuit breaker config.
+type BreakerOption struct {
+	Window           time.Duration // sliding window of the call results (default 10s).
+	Buckets          int           // buckets of the sliding window (default 10).
+	MinRequests      int64         // min calls in window before the rates are checked (default 20).
+	FailureRate      float64       // open if the rate of failed calls reaches it (default 0.5).
+	SlowCallDuration time.Duration // the call is slow if it takes longer (default 0, disabled).
+	SlowCallRate     float64       // open if the rate of slow calls reaches it (default 1).
+	OpenTimeout      time.Duration // time in open state before probing (default 30s).
+	Probes           int64         // successful probes in half-open state to close (default 5).
+
+	// OnStateChange is called without lock when the state changes.
+	OnStateChange func(from, to State)
+	Clock         gtime.Clock // default gtime.RealClock.
+}
+
+// BreakerStats is the Statistics of circuit breaker.
+type BreakerStats struct {
+	State     State
+	Total     int64 // calls in window
+	Failures  int64 // failed calls in window
+	SlowCalls int64 // slow calls in window
+}
+
+type breakerBucket struct {
+	start     time.Time
+	total     int64
+	failures  int64
+	slowCalls int64
+}
+
+// Breaker is the circuit breaker, it implements Limiter,
+// the caller reports the result of call with done: Drop as failure,
+// Success as success (or slow call), Ignore is not recorded.
+type Breaker struct {
+	option BreakerOption
+	width  time.Duration
+
+	mu         sync.Mutex
+	state      State
+	generation int64
+	openAt     time.Time
+	buckets    []breakerBucket
+	probing    int64 // probes in flight
+	probed     int64 // successful probes
+}
+
+// NewBreaker creates a circuit breaker.
+func NewBreaker(opt ...BreakerOption) *Breaker {
+	option := BreakerOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Window <= 0 {
+		option.Window = 10 * time.Second
+	}
+	if option.Buckets <= 0 {
+		option.Buckets = 10
+	}
+	if time.Duration(option.Buckets) > option.Window {
+		// every bucket is at least 1ns wide
+		option.Buckets = int(option.Window)
+	}
+	if option.MinRequests <= 0 {
+		option.MinRequests = 20
+	}
+	if option.FailureRate <= 0 || option.FailureRate > 1 {
+		option.FailureRate = 0.5
+	}
+	if option.SlowCallRate <= 0 || option.SlowCallRate > 1 {
+		option.SlowCallRate = 1
+	}
+	if option.OpenTimeout <= 0 {
+		option.OpenTimeout = 30 * time.Second
+	}
+	if option.Probes <= 0 {
+		option.Probes = 5
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+
+	return &Breaker{
+		option:  option,
+		width:   option.Window / time.Duration(option.Buckets),
+		buckets: make([]breakerBucket, option.Buckets),
+	}
+}
+
+// Allow implements Limiter.
+// if error is returned, no need to call done()
+func (b *Breaker) Allow(ctx context.Context) (func(Operation), error) {
+	now := b.option.Clock.Now()
+
+	b.mu.Lock()
+	from, to := b.advance(now)
+	var err error
+	switch b.state {
+	case StateOpen:
+		err = ErrBreakerOpen
+	case StateHalfOpen:
+		if b.probing+b.probed >= b.option.Probes {
+			err = ErrTooManyProbes
+		} else {
+			b.probing++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(from, to)
+
+	if err != nil {
+		return func(Operation) {}, err
+	}
+	return func(op Operation) {
+		b.done(generation, now, op)
+	}, nil
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	from, to := b.advance(b.option.Clock.Now())
+	state := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return state
+}
+
+// Stats return the statistics of circuit breaker.
+func (b *Breaker) Stats() BreakerStats {
+	now := b.option.Clock.Now()
+
+	b.mu.Lock()
+	from, to := b.advance(now)
+	stats := BreakerStats{State: b.state}
+	stats.Total, stats.Failures, stats.SlowCalls = b.count(now)
+	b.mu.Unlock()
+	b.notify(from, to)
+	return stats
+}
+
+func (b *Breaker) done(generation int64, start time.Time, op Operation) {
+	now := b.option.Clock.Now()
+	slow := b.option.SlowCallDuration > 0 && now.Sub(start) >= b.option.SlowCallDuration
+
+	b.mu.Lock()
+	from, to := b.state, b.state
+	if generation == b.generation {
+		switch b.state {
+		case StateClosed:
+			if op != Ignore {
+				from, to = b.record(now, op == Drop, slow)
+			}
+		case StateHalfOpen:
+			b.probing--
+			if op == Drop || (op == Success && slow) {
+				from, to = b.transit(StateOpen, now)
+			} else if op == Success {
+				b.probed++
+				if b.probed >= b.option.Probes {
+					from, to = b.transit(StateClosed, now)
+				}
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// record the result in closed state and opens if the rates are reached, must hold lock.
+func (b *Breaker) record(now time.Time, failure, slow bool) (State, State) {
+	bucket := b.bucket(now)
+	bucket.total++
+	if failure {
+		bucket.failures++
+	} else if slow {
+		bucket.slowCalls++
+	}
+
+	total, failures, slowCalls := b.count(now)
+	if total < b.option.MinRequests {
+		return b.state, b.state
+	}
+	if float64(failures) >= b.option.FailureRate*float64(total) ||
+		(b.option.SlowCallDuration > 0 && float64(slowCalls) >= b.option.SlowCallRate*float64(total)) {
+		return b.transit(StateOpen, now)
+	}
+	return b.state, b.state
+}
+
+// bucket returns the bucket of now, resets it if expired, must hold lock.
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	start := now.Truncate(b.width)
+	// the index is negative before 1970
+	n := int64(len(b.buckets))
+	bucket := &b.buckets[((start.UnixNano()/int64(b.width))%n+n)%n]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// count the calls in window, must hold lock.
+func (b *Breaker) count(now time.Time) (total, failures, slowCalls int64) {
+	for i := range b.buckets {
+		bucket := &b.buckets[i]
+		if now.Sub(bucket.start) >= b.option.Window {
+			continue
+		}
+		total += bucket.total
+		failures += bucket.failures
+		slowCalls += bucket.slowCalls
+	}
+	return
+}
+
+// advance moves open state to half-open after OpenTimeout, must hold lock.
+func (b *Breaker) advance(now time.Time) (State, State) {
+	if b.state == StateOpen && now.Sub(b.openAt) >= b.option.OpenTimeout {
+		return b.transit(StateHalfOpen, now)
+	}
+	return b.state, b.state
+}
+
+// transit changes the state and resets the records, must hold lock.
+func (b *Breaker) transit(state State, now time.Time) (State, State) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probing, b.probed = 0, 0
+	if state == StateOpen {
+		b.openAt = now
+	}
+	if state == StateClosed {
+		for i := range b.buckets {
+			b.buckets[i] = breakerBucket{}
+		}
+	}
+	return from, state
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.option.OnStateChange != nil {
+		b.option.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,122 @@
+package grate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+func call(t *testing.T, b *Breaker, op Operation) {
+	done, err := b.Allow(context.Background())
+	if err != nil {
+		t.Fatalf("Should be allowed, but (%v)", err)
+	}
+	done(op)
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	clock := newManualClock()
+	var changes []State
+	b := NewBreaker(BreakerOption{
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenTimeout: time.Second,
+		Probes:      2,
+		Clock:       clock,
+		OnStateChange: func(from, to State) {
+			changes = append(changes, to)
+		},
+	})
+
+	call(t, b, Success)
+	call(t, b, Success)
+	call(t, b, Drop)
+	call(t, b, Ignore)
+	if b.State() != StateClosed {
+		t.Fatalf("Should be closed below min requests, but (%v)", b.State())
+	}
+	call(t, b, Drop)
+	if b.State() != StateOpen {
+		t.Fatalf("Should be open on failure rate, but (%v)", b.State())
+	}
+	if _, err := b.Allow(context.Background()); err != ErrBreakerOpen {
+		t.Fatalf("Should be rejected in open state, but (%v)", err)
+	}
+
+	clock.Advance(time.Second)
+	done1, err1 := b.Allow(context.Background())
+	done2, err2 := b.Allow(context.Background())
+	if _, err := b.Allow(context.Background()); err1 != nil || err2 != nil || err != ErrTooManyProbes {
+		t.Fatalf("Should allow 2 probes in half-open state, but (%v, %v, %v)", err1, err2, err)
+	}
+	done1(Success)
+	done2(Drop)
+	if b.State() != StateOpen {
+		t.Fatalf("Should be open on failed probe, but (%v)", b.State())
+	}
+
+	clock.Advance(time.Second)
+	call(t, b, Success)
+	call(t, b, Success)
+	if stats := b.Stats(); stats.State != StateClosed || stats.Total != 0 {
+		t.Fatalf("Should be closed and reset after probes, but (%+v)", stats)
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("Should change state %v, but (%v)", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("Should change state %v, but (%v)", want, changes)
+		}
+	}
+}
+
+func TestBreakerSlowCall(t *testing.T) {
+	clock := newManualClock()
+	b := NewBreaker(BreakerOption{MinRequests: 2, SlowCallDuration: time.Second, SlowCallRate: 0.5, Clock: clock})
+
+	call(t, b, Success)
+	done, _ := b.Allow(context.Background())
+	clock.Advance(2 * time.Second)
+	done(Success)
+	if stats := b.Stats(); stats.State != StateOpen || stats.SlowCalls != 1 {
+		t.Fatalf("Should be open on slow call rate, but (%+v)", stats)
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	clock := newManualClock()
+	b := NewBreaker(BreakerOption{Window: 10 * time.Second, MinRequests: 2, Clock: clock})
+
+	call(t, b, Drop)
+	clock.Advance(10 * time.Second)
+	call(t, b, Success)
+	if stats := b.Stats(); stats.State != StateClosed || stats.Total != 1 {
+		t.Fatalf("Should slide out the old calls, but (%+v)", stats)
+	}
+}
+
+func TestBreakerTinyWindow(t *testing.T) {
+	b := NewBreaker(BreakerOption{Window: 5, Buckets: 10, Clock: newManualClock()})
+	if b.width != 1 || len(b.buckets) != 5 {
+		t.Fatalf("Should clamp the bucket width to 1ns, but (%v, %d)", b.width, len(b.buckets))
+	}
+	call(t, b, Success)
+}
+
+func TestBreakerClockBefore1970(t *testing.T) {
+	for _, start := range []time.Time{{}, time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		clock := gtime.NewFakeClock(start)
+		b := NewBreaker(BreakerOption{MinRequests: 2, Clock: clock})
+		call(t, b, Drop)
+		clock.Advance(time.Second)
+		call(t, b, Drop)
+		if stats := b.Stats(); stats.State != StateOpen || stats.Total != 2 {
+			t.Fatalf("Should open at %v, but (%+v)", start, stats)
+		}
+	}
+}
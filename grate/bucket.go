@@ -0,0 +1,307 @@
+package grate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// BucketOption token bucket and leaky bucket config.
+type BucketOption struct {
+	Rate  float64     // events per second (default 100).
+	Burst int         // bucket size, max events allowed at once or waiting in queue (default 1).
+	Clock gtime.Clock // default gtime.RealClock.
+}
+
+// BucketStats is the Statistics of token bucket and leaky bucket.
+type BucketStats struct {
+	Rate   float64
+	Burst  int
+	Tokens float64 // available tokens of token bucket, or free slots of leaky bucket
+}
+
+// Reservation holds information about events that are permitted by a bucket after a delay.
+type Reservation struct {
+	ok        bool
+	timeToAct time.Time
+	cancel    func()
+	clock     gtime.Clock
+}
+
+// OK returns whether the bucket can provide the requested events within the maximum wait time.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns the duration for which the reservation holder must wait before taking the action.
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(r.clock.Now())
+}
+
+// DelayFrom returns the duration for which the reservation holder must wait before taking the action
+// from the given time.
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+	delay := r.timeToAct.Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Cancel indicates that the reservation holder will not perform the action,
+// and gives back the reserved events as much as possible.
+func (r *Reservation) Cancel() {
+	if r.ok && r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// wait blocks until the time to act, or ctx is done.
+func (r *Reservation) wait(ctx context.Context) error {
+	if !r.ok {
+		return ErrLimitExceed
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+		r.Cancel()
+		return ErrDeadline
+	}
+
+	timer := r.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ErrDeadline
+	}
+}
+
+// TokenBucket is a token bucket limiter, the bucket is refilled at Rate tokens per second,
+// and holds Burst tokens at most.
+type TokenBucket struct {
+	mu     sync.Mutex
+	option BucketOption
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket limiter, the bucket is full initially.
+func NewTokenBucket(opt ...BucketOption) *TokenBucket {
+	option := newBucketOption(opt...)
+	return &TokenBucket{
+		option: option,
+		tokens: float64(option.Burst),
+		last:   option.Clock.Now(),
+	}
+}
+
+// Allow implements Limiter, returns ErrLimitExceed if no token is available now.
+func (tb *TokenBucket) Allow(ctx context.Context) (func(Operation), error) {
+	if !tb.AllowN(tb.option.Clock.Now(), 1) {
+		return func(Operation) {}, ErrLimitExceed
+	}
+	return func(Operation) {}, nil
+}
+
+// AllowN reports whether n tokens are available at time now, and takes them if so.
+func (tb *TokenBucket) AllowN(now time.Time, n int) bool {
+	return tb.reserveN(now, n, 0).ok
+}
+
+// Wait blocks until a token is available, returns ErrDeadline if ctx is done before that.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	return tb.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available, returns ErrDeadline if ctx is done before that,
+// or ErrLimitExceed if n exceeds the burst.
+func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	return tb.reserveN(tb.option.Clock.Now(), n, time.Duration(math.MaxInt64)).wait(ctx)
+}
+
+// Reserve returns a Reservation that indicates how long the caller must wait before a token is available.
+func (tb *TokenBucket) Reserve() *Reservation {
+	return tb.ReserveN(tb.option.Clock.Now(), 1)
+}
+
+// ReserveN returns a Reservation that indicates how long the caller must wait before n tokens are available.
+// The reservation is not OK if n exceeds the burst.
+func (tb *TokenBucket) ReserveN(now time.Time, n int) *Reservation {
+	return tb.reserveN(now, n, time.Duration(math.MaxInt64))
+}
+
+// Stats return the statistics of token bucket.
+func (tb *TokenBucket) Stats() BucketStats {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	return BucketStats{
+		Rate:   tb.option.Rate,
+		Burst:  tb.option.Burst,
+		Tokens: tb.advance(tb.option.Clock.Now()),
+	}
+}
+
+// advance return the tokens at time now, must hold lock.
+func (tb *TokenBucket) advance(now time.Time) float64 {
+	last := tb.last
+	if now.Before(last) {
+		last = now
+	}
+	tokens := tb.tokens + now.Sub(last).Seconds()*tb.option.Rate
+	if burst := float64(tb.option.Burst); tokens > burst {
+		tokens = burst
+	}
+	return tokens
+}
+
+func (tb *TokenBucket) reserveN(now time.Time, n int, maxWait time.Duration) *Reservation {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if n > tb.option.Burst {
+		return &Reservation{clock: tb.option.Clock}
+	}
+
+	tokens := tb.advance(now) - float64(n)
+	var wait time.Duration
+	if tokens < 0 {
+		wait = time.Duration(-tokens / tb.option.Rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return &Reservation{clock: tb.option.Clock}
+	}
+
+	tb.last = now
+	tb.tokens = tokens
+	r := &Reservation{ok: true, timeToAct: now.Add(wait), clock: tb.option.Clock}
+	r.cancel = func() {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+		// tokens reserved by the later reservations can't be given back
+		if r.timeToAct.After(tb.option.Clock.Now()) {
+			tb.tokens += float64(n)
+		}
+	}
+	return r
+}
+
+// LeakyBucket is a leaky bucket limiter, events leak out of the bucket at a constant Rate,
+// and at most Burst events could wait in the bucket.
+type LeakyBucket struct {
+	mu       sync.Mutex
+	option   BucketOption
+	interval time.Duration
+	next     time.Time // the time that the next event could leak out
+}
+
+// NewLeakyBucket creates a leaky bucket limiter.
+func NewLeakyBucket(opt ...BucketOption) *LeakyBucket {
+	option := newBucketOption(opt...)
+	return &LeakyBucket{
+		option:   option,
+		interval: time.Duration(float64(time.Second) / option.Rate),
+	}
+}
+
+// Allow implements Limiter, it blocks until the event leaks out of the bucket,
+// returns ErrLimitExceed if the bucket is full, or ErrDeadline if ctx is done before that.
+func (lb *LeakyBucket) Allow(ctx context.Context) (func(Operation), error) {
+	if err := lb.Wait(ctx); err != nil {
+		return func(Operation) {}, err
+	}
+	return func(Operation) {}, nil
+}
+
+// Wait blocks until the event leaks out of the bucket,
+// returns ErrLimitExceed if the bucket is full, or ErrDeadline if ctx is done before that.
+func (lb *LeakyBucket) Wait(ctx context.Context) error {
+	return lb.ReserveN(lb.option.Clock.Now(), 1).wait(ctx)
+}
+
+// Reserve returns a Reservation that indicates how long the caller must wait in the bucket.
+func (lb *LeakyBucket) Reserve() *Reservation {
+	return lb.ReserveN(lb.option.Clock.Now(), 1)
+}
+
+// ReserveN returns a Reservation that indicates how long the caller must wait in the bucket for n events.
+// The reservation is not OK if the bucket is full.
+func (lb *LeakyBucket) ReserveN(now time.Time, n int) *Reservation {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	next := lb.next
+	if next.Before(now) {
+		next = now
+	}
+
+	// events in the bucket include this one
+	waiting := int(next.Sub(now)/lb.interval) + n
+	if waiting > lb.option.Burst {
+		return &Reservation{clock: lb.option.Clock}
+	}
+
+	timeToAct := next
+	cost := lb.interval * time.Duration(n)
+	lb.next = next.Add(cost)
+
+	r := &Reservation{ok: true, timeToAct: timeToAct, clock: lb.option.Clock}
+	r.cancel = func() {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		if r.timeToAct.After(lb.option.Clock.Now()) {
+			lb.next = lb.next.Add(-cost)
+		}
+	}
+	return r
+}
+
+// Stats return the statistics of leaky bucket.
+func (lb *LeakyBucket) Stats() BucketStats {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.option.Clock.Now()
+	free := float64(lb.option.Burst)
+	if lb.next.After(now) {
+		free -= float64(lb.next.Sub(now)) / float64(lb.interval)
+	}
+	return BucketStats{
+		Rate:   lb.option.Rate,
+		Burst:  lb.option.Burst,
+		Tokens: math.Max(0, free),
+	}
+}
+
+func newBucketOption(opt ...BucketOption) BucketOption {
+	option := BucketOption{
+		Rate:  100,
+		Burst: 1,
+	}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Rate <= 0 {
+		option.Rate = 100
+	}
+	if option.Burst <= 0 {
+		option.Burst = 1
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+	return option
+}
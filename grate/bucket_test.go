@@ -0,0 +1,168 @@
+package grate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	tb := NewTokenBucket(BucketOption{Rate: 10, Burst: 5})
+	now := time.Now()
+
+	if !tb.AllowN(now, 5) {
+		t.Fatalf("Should allow burst of 5 tokens")
+	}
+	if tb.AllowN(now, 1) {
+		t.Fatalf("Should be rejected when bucket is empty")
+	}
+	if !tb.AllowN(now.Add(100*time.Millisecond), 1) {
+		t.Fatalf("Should allow 1 token after 100ms")
+	}
+	if tb.AllowN(now.Add(time.Second), 6) {
+		t.Fatalf("Should be rejected when n exceeds burst")
+	}
+	if !tb.AllowN(now.Add(10*time.Second), 5) {
+		t.Fatalf("Should allow burst of 5 tokens after refill")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	tb := NewTokenBucket(BucketOption{Rate: 10, Burst: 1})
+	now := time.Now()
+
+	r1 := tb.ReserveN(now, 1)
+	r2 := tb.ReserveN(now, 1)
+	r3 := tb.ReserveN(now, 1)
+	if !r1.OK() || r1.DelayFrom(now) != 0 {
+		t.Fatalf("First reservation should act now, but delay (%v)", r1.DelayFrom(now))
+	}
+	if r2.DelayFrom(now) != 100*time.Millisecond || r3.DelayFrom(now) != 200*time.Millisecond {
+		t.Fatalf("Reservations should be delayed, but (%v, %v)", r2.DelayFrom(now), r3.DelayFrom(now))
+	}
+
+	r3.Cancel()
+	r4 := tb.ReserveN(now, 1)
+	if r4.DelayFrom(now) != 200*time.Millisecond {
+		t.Fatalf("Canceled reservation should give back token, but delay (%v)", r4.DelayFrom(now))
+	}
+	if tb.ReserveN(now, 2).OK() {
+		t.Fatalf("Reservation should not be OK when n exceeds burst")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tb := NewTokenBucket(BucketOption{Rate: 100, Burst: 1})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := tb.Wait(ctx); err != nil {
+			t.Fatalf("Wait should succeed, but (%v)", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("Wait should take about 40ms, but (%v)", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	tb.AllowN(time.Now(), 1)
+	if err := tb.Wait(ctx); err != ErrDeadline {
+		t.Fatalf("Wait should return ErrDeadline, but (%v)", err)
+	}
+	if _, err := tb.Allow(ctx); err != ErrLimitExceed {
+		t.Fatalf("Allow should return ErrLimitExceed, but (%v)", err)
+	}
+}
+
+func TestLeakyBucket(t *testing.T) {
+	lb := NewLeakyBucket(BucketOption{Rate: 10, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		r := lb.ReserveN(now, 1)
+		if !r.OK() || r.DelayFrom(now) != time.Duration(i)*100*time.Millisecond {
+			t.Fatalf("Reservation %d should leak at %v, but (%v)", i, time.Duration(i)*100*time.Millisecond, r.DelayFrom(now))
+		}
+	}
+	if lb.ReserveN(now, 1).OK() {
+		t.Fatalf("Reservation should not be OK when bucket is full")
+	}
+
+	r := lb.ReserveN(now.Add(100*time.Millisecond), 1)
+	if !r.OK() || r.DelayFrom(now) != 300*time.Millisecond {
+		t.Fatalf("Reservation should leak at 300ms, but (%v)", r.DelayFrom(now))
+	}
+}
+
+func TestLeakyBucketAllow(t *testing.T) {
+	lb := NewLeakyBucket(BucketOption{Rate: 100, Burst: 2})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := lb.Allow(ctx); err != nil {
+			t.Fatalf("Allow should succeed, but (%v)", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 8*time.Millisecond {
+		t.Fatalf("Second event should leak after 10ms, but (%v)", elapsed)
+	}
+
+	lb.Reserve()
+	lb.Reserve()
+	if _, err := lb.Allow(ctx); err != ErrLimitExceed {
+		t.Fatalf("Allow should return ErrLimitExceed, but (%v)", err)
+	}
+}
+
+func TestTokenBucketClock(t *testing.T) {
+	clock := newManualClock()
+	tb := NewTokenBucket(BucketOption{Rate: 10, Burst: 1, Clock: clock})
+	ctx := context.Background()
+
+	if err := tb.Wait(ctx); err != nil {
+		t.Fatalf("Wait should succeed, but (%v)", err)
+	}
+	if d := tb.Reserve().Delay(); d != 100*time.Millisecond {
+		t.Fatalf("Reservation should wait 100ms, but (%v)", d)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- tb.Wait(ctx) }()
+	clock.BlockUntil(1)
+	clock.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("Wait should succeed after the clock advances, but (%v)", err)
+	}
+
+	clock.Advance(time.Second)
+	if stats := tb.Stats(); stats.Tokens != 1 {
+		t.Fatalf("Bucket should be refilled, but (%+v)", stats)
+	}
+}
+
+func TestLeakyBucketClock(t *testing.T) {
+	clock := newManualClock()
+	lb := NewLeakyBucket(BucketOption{Rate: 10, Burst: 2, Clock: clock})
+	ctx := context.Background()
+
+	if _, err := lb.Allow(ctx); err != nil {
+		t.Fatalf("Allow should succeed, but (%v)", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := lb.Allow(ctx)
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	if stats := lb.Stats(); stats.Tokens != 0 {
+		t.Fatalf("Bucket should be full, but (%+v)", stats)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("Allow should succeed after the clock advances, but (%v)", err)
+	}
+}
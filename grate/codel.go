@@ -1,11 +1,15 @@
 package grate
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/xtfly/gokits/gtime"
 )
 
 var (
@@ -13,10 +17,47 @@ var (
 	ErrDeadline    = errors.New("deal line")
 )
 
+// Criticality is the priority of request, the lower criticality requests are shed first under overload.
+type Criticality int
+
+const (
+	// Sheddable criticality: the request could be dropped first
+	Sheddable Criticality = iota
+	// SheddablePlus criticality: the request could be dropped, retry is expected
+	SheddablePlus
+	// Critical criticality: the default criticality of request
+	Critical
+	// CriticalPlus criticality: the request is never dropped by CoDel unless the queue is full
+	CriticalPlus
+
+	criticalityNum = int(CriticalPlus) + 1
+)
+
+// targetFactor is the multiple of target queue delay tolerated by each criticality.
+var targetFactor = [criticalityNum]int64{1, 2, 4, 0}
+
+type criticalityCtx struct{}
+
+// NewContextWithCriticality returns a new context that carries the criticality of request.
+func NewContextWithCriticality(ctx context.Context, c Criticality) context.Context {
+	return context.WithValue(ctx, criticalityCtx{}, c)
+}
+
+// CriticalityFromContext returns the criticality carried by ctx, default Critical.
+func CriticalityFromContext(ctx context.Context) Criticality {
+	c, ok := ctx.Value(criticalityCtx{}).(Criticality)
+	if !ok || c < Sheddable || c > CriticalPlus {
+		return Critical
+	}
+	return c
+}
+
 // CoDelOption CoDel queue config.
 type CoDelOption struct {
-	Target   int64 // target queue delay (default 20 ms).
-	Internal int64 // sliding minimum time window width (default 500 ms)
+	Target   int64       // target queue delay (default 20 ms).
+	Internal int64       // sliding minimum time window width (default 500 ms)
+	Capacity int         // max requests in queue (default 2048)
+	Clock    gtime.Clock // default gtime.RealClock
 }
 
 // CoDelStats is the Statistics of CoDel queue.
@@ -25,17 +66,23 @@ type CoDelStats struct {
 	FaTime   int64
 	DropNext int64
 	Packets  int
+	Drops    map[Criticality]int64 // dropped requests of each criticality, include rejected by full queue
 }
 
 type queuePacket struct {
-	dropChan  chan bool
-	timestamp int64
+	dropChan    chan bool
+	timestamp   int64
+	criticality Criticality
+	labelled    bool // the criticality is carried by ctx explicitly
 }
 
 // CoDel is CoDel req buffer queue.
 type CoDel struct {
 	pool     sync.Pool
-	packets  chan queuePacket
+	qmux     sync.Mutex                 // guard packets and size
+	packets  [criticalityNum]*list.List // queued packets of each criticality, oldest at front
+	size     int64                      // total of packets, never exceed Capacity
+	drops    [criticalityNum]int64
 	mux      sync.RWMutex
 	option   *CoDelOption
 	count    int64
@@ -53,10 +100,18 @@ func NewCoDel(opt ...CoDelOption) *CoDel {
 	if len(opt) >= 1 {
 		option = opt[0]
 	}
+	if option.Capacity <= 0 {
+		option.Capacity = 2048
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
 
 	q := &CoDel{
-		packets: make(chan queuePacket, 2048),
-		option:  &option,
+		option: &option,
+	}
+	for c := range q.packets {
+		q.packets[c] = list.New()
 	}
 
 	q.pool.New = func() interface{} {
@@ -70,31 +125,37 @@ func (q *CoDel) Stats() CoDelStats {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
+	drops := make(map[Criticality]int64, criticalityNum)
+	for c := range q.drops {
+		drops[Criticality(c)] = atomic.LoadInt64(&q.drops[c])
+	}
+
 	return CoDelStats{
 		Dropping: q.dropping,
 		FaTime:   q.faTime,
 		DropNext: q.dropNext,
-		Packets:  len(q.packets),
+		Packets:  int(atomic.LoadInt64(&q.size)),
+		Drops:    drops,
 	}
 }
 
-// Push req into CoDel request buffer queue.
+// Push req into CoDel request buffer queue, the criticality of req is carried by ctx.
+// if the queue is full, a queued req with lower criticality is dropped to make room.
+// the req without criticality in ctx is queued as Critical, but judged by the plain CoDel.
 // if return error is nil,the caller must call q.Done() after finish request handling
 func (q *CoDel) Push(ctx context.Context) (err error) {
+	c := CriticalityFromContext(ctx)
+	_, labelled := ctx.Value(criticalityCtx{}).(Criticality)
 	r := queuePacket{
-		dropChan:  q.pool.Get().(chan bool),
-		timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		dropChan:    q.pool.Get().(chan bool),
+		timestamp:   q.now(),
+		criticality: c,
+		labelled:    labelled,
 	}
-
-	select {
-	case q.packets <- r:
-	default:
-		err = ErrLimitExceed
+	if !q.push(r) {
+		atomic.AddInt64(&q.drops[c], 1)
 		q.pool.Put(r.dropChan)
-	}
-
-	if err != nil {
-		return
+		return ErrLimitExceed
 	}
 
 	select {
@@ -109,24 +170,76 @@ func (q *CoDel) Push(ctx context.Context) (err error) {
 	return
 }
 
-// Pop req from CoDel request buffer queue.
+// Pop req from CoDel request buffer queue, the higher criticality req is popped first.
 func (q *CoDel) Pop() {
 	for {
+		p, ok := q.pop()
+		if !ok {
+			return
+		}
+
+		drop := q.judge(p)
+		if drop {
+			atomic.AddInt64(&q.drops[p.criticality], 1)
+		}
 		select {
-		case p := <-q.packets:
-			drop := q.judge(p)
-			select {
-			case p.dropChan <- drop:
-				if !drop {
-					return
-				}
-			default:
-				q.pool.Put(p.dropChan)
+		case p.dropChan <- drop:
+			if !drop {
+				return
 			}
 		default:
-			return
+			q.pool.Put(p.dropChan)
+		}
+	}
+}
+
+func (q *CoDel) pop() (queuePacket, bool) {
+	q.qmux.Lock()
+	defer q.qmux.Unlock()
+
+	for c := criticalityNum - 1; c >= 0; c-- {
+		if e := q.packets[c].Front(); e != nil {
+			q.packets[c].Remove(e)
+			atomic.AddInt64(&q.size, -1)
+			return e.Value.(queuePacket), true
+		}
+	}
+	return queuePacket{}, false
+}
+
+// push the packet into queue, it drops the oldest packet of the lowest criticality
+// lower than p if the queue is full, returns false if there is no room for p.
+func (q *CoDel) push(p queuePacket) bool {
+	q.qmux.Lock()
+	defer q.qmux.Unlock()
+
+	if q.size >= int64(q.option.Capacity) {
+		evicted, ok := q.evict(p.criticality)
+		if !ok {
+			return false
+		}
+		atomic.AddInt64(&q.drops[evicted.criticality], 1)
+		select {
+		case evicted.dropChan <- true:
+		default:
+			q.pool.Put(evicted.dropChan)
 		}
 	}
+	q.packets[p.criticality].PushBack(p)
+	atomic.AddInt64(&q.size, 1)
+	return true
+}
+
+// evict removes a queued packet whose criticality is lower than c, must hold qmux.
+func (q *CoDel) evict(c Criticality) (queuePacket, bool) {
+	for lc := Sheddable; lc < c; lc++ {
+		if e := q.packets[lc].Front(); e != nil {
+			q.packets[lc].Remove(e)
+			atomic.AddInt64(&q.size, -1)
+			return e.Value.(queuePacket), true
+		}
+	}
+	return queuePacket{}, false
 }
 
 func (q *CoDel) controlLaw(now int64) int64 {
@@ -145,15 +258,26 @@ func (q *CoDel) checkFaTime(now, elapsed int64) (drop bool) {
 	return false
 }
 
-// judge decide if the packet should drop or not.
+// now returns the current time in milliseconds.
+func (q *CoDel) now() int64 {
+	return q.option.Clock.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// judge decide if the packet should drop or not, the packet with criticality labelled
+// is spared until its delay exceeds the multiple of target, the drop state is not
+// advanced for the spared packet.
 func (q *CoDel) judge(p queuePacket) (drop bool) {
-	now := time.Now().UnixNano() / int64(time.Millisecond)
+	now := q.now()
 	elapsed := now - p.timestamp
 
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
 	drop = q.checkFaTime(now, elapsed)
+	if drop && p.labelled && !q.sheddable(p, elapsed) {
+		return false
+	}
+
 	if q.dropping {
 		if !drop {
 			// elapsed time below target - leave dropping state
@@ -188,3 +312,12 @@ func (q *CoDel) judge(p queuePacket) (drop bool) {
 	}
 	return
 }
+
+// sheddable reports whether the packet could be dropped with its queue delay.
+func (q *CoDel) sheddable(p queuePacket, elapsed int64) bool {
+	if p.criticality == Sheddable {
+		return true
+	}
+	factor := targetFactor[p.criticality]
+	return factor > 0 && elapsed >= q.option.Target*factor
+}
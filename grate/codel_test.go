@@ -3,6 +3,8 @@ package grate
 import (
 	"context"
 	"fmt"
+	"math"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -92,3 +94,138 @@ func BenchmarkAQM(b *testing.B) {
 		}
 	})
 }
+
+func TestCoDelCapacity(t *testing.T) {
+	q := NewCoDel(CoDelOption{Target: 20, Internal: 500, Capacity: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pushed := make(chan error, 1)
+	go func() { pushed <- q.Push(NewContextWithCriticality(ctx, Sheddable)) }()
+	for q.Stats().Packets != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := q.Push(NewContextWithCriticality(ctx, Sheddable)); err != ErrLimitExceed {
+		t.Fatalf("Should reject same criticality when queue is full, but (%v)", err)
+	}
+
+	// the critical request evicts the queued sheddable request
+	critical := make(chan error, 1)
+	go func() { critical <- q.Push(ctx) }()
+	if err := <-pushed; err != ErrLimitExceed {
+		t.Fatalf("Sheddable request should be evicted, but (%v)", err)
+	}
+	for q.Stats().Packets != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Pop()
+	if err := <-critical; err != nil {
+		t.Fatalf("Critical request should be popped, but (%v)", err)
+	}
+
+	if drops := q.Stats().Drops; drops[Sheddable] != 2 || drops[Critical] != 0 {
+		t.Fatalf("Should drop 2 sheddable requests, but (%v)", drops)
+	}
+}
+
+func TestCoDelSpareState(t *testing.T) {
+	clock := newManualClock()
+	q := NewCoDel(CoDelOption{Target: 20, Internal: 500, Clock: clock})
+	packet := func(c Criticality, delay int64) queuePacket {
+		return queuePacket{timestamp: q.now() - delay, criticality: c, labelled: true}
+	}
+
+	q.judge(packet(Critical, 30))
+	clock.Advance(1100 * time.Millisecond)
+	// above target for two intervals, but the critical request is below 4 times of target
+	if q.judge(packet(Critical, 30)) {
+		t.Fatal("Critical request should be spared")
+	}
+	if stats := q.Stats(); stats.Dropping || q.count != 0 {
+		t.Fatalf("Should not enter drop state for spared request, but (%+v)", stats)
+	}
+	if !q.judge(packet(Sheddable, 30)) || !q.Stats().Dropping {
+		t.Fatal("Sheddable request should be dropped")
+	}
+}
+
+// baselineCoDel is the drop decision of CoDel before the criticality was introduced.
+type baselineCoDel struct {
+	target, internal        int64
+	dropping                bool
+	count, faTime, dropNext int64
+}
+
+func (q *baselineCoDel) judge(now, elapsed int64) (drop bool) {
+	if elapsed < q.target {
+		q.faTime = 0
+	} else if q.faTime == 0 {
+		q.faTime = now + q.internal
+	} else if now >= q.faTime {
+		drop = true
+	}
+
+	if q.dropping {
+		if !drop {
+			q.dropping = false
+			return
+		}
+		if now > q.dropNext {
+			q.count++
+			q.dropNext = q.dropNext + int64(float64(q.internal)/math.Sqrt(float64(q.count)))
+			return true
+		}
+	}
+	if drop && (now-q.dropNext < q.internal || now-q.faTime >= q.internal) {
+		q.dropping = true
+		if now-q.dropNext < q.internal {
+			if q.count > 2 {
+				q.count = q.count - 2
+			} else {
+				q.count = 1
+			}
+		} else {
+			q.count = 1
+		}
+		q.dropNext = now + int64(float64(q.internal)/math.Sqrt(float64(q.count)))
+		return true
+	}
+	return
+}
+
+func TestCoDelUnlabelled(t *testing.T) {
+	clock := newManualClock()
+	q := NewCoDel(CoDelOption{Target: 20, Internal: 500, Clock: clock})
+	baseline := &baselineCoDel{target: 20, internal: 500}
+	r := rand.New(rand.NewSource(1))
+
+	drops := 0
+	for i := 0; i < 10000; i++ {
+		clock.Advance(time.Duration(r.Intn(20)) * time.Millisecond)
+		// alternate the normal and overload periods, with a few short requests in overload
+		delay := int64(r.Intn(25))
+		if (i/1000)%2 == 1 && r.Intn(50) > 0 {
+			delay = 20 + int64(r.Intn(40))
+		}
+		drop := q.judge(queuePacket{timestamp: q.now() - delay, criticality: Critical})
+		if expect := baseline.judge(q.now(), delay); drop != expect {
+			t.Fatalf("Should judge unlabelled request as baseline at %d, but (%v)", i, drop)
+		}
+		if drop {
+			drops++
+		}
+	}
+	if drops == 0 {
+		t.Fatal("Should drop some requests")
+	}
+}
+
+func TestCriticalityFromContext(t *testing.T) {
+	if c := CriticalityFromContext(context.Background()); c != Critical {
+		t.Fatalf("Default criticality should be Critical, but (%v)", c)
+	}
+	if c := CriticalityFromContext(NewContextWithCriticality(context.Background(), SheddablePlus)); c != SheddablePlus {
+		t.Fatalf("Criticality should be SheddablePlus, but (%v)", c)
+	}
+}
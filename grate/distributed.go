@@ -0,0 +1,283 @@
+package grate
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// Store is the shared storage of the token state of DistributedLimiter,
+// it could be implemented by redis with INCRBY and PEXPIRE in a script.
+type Store interface {
+	// IncrBy atomically adds n to the value of key and returns the new value,
+	// the key expires after ttl since it is created.
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+type memoryEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+// MemoryStore is the in-process Store, it is used in tests or by the replicas of one process.
+type MemoryStore struct {
+	clock     gtime.Clock
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a in-memory store, the clock is gtime.RealClock if nil.
+func NewMemoryStore(clock gtime.Clock) *MemoryStore {
+	if clock == nil {
+		clock = gtime.RealClock
+	}
+	return &MemoryStore{clock: clock, entries: make(map[string]*memoryEntry)}
+}
+
+// IncrBy implements Store.
+func (s *MemoryStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, ttl)
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expireAt) {
+		e = &memoryEntry{expireAt: now.Add(ttl)}
+		s.entries[key] = e
+	}
+	e.value += n
+	return e.value, nil
+}
+
+// Len returns the number of unexpired keys.
+func (s *MemoryStore) Len() int {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, e := range s.entries {
+		if now.Before(e.expireAt) {
+			n++
+		}
+	}
+	return n
+}
+
+// sweep removes the expired keys at most once per ttl, must hold lock.
+func (s *MemoryStore) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(s.lastSweep) < ttl {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if !now.Before(e.expireAt) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// DistributedOption distributed limiter config.
+type DistributedOption struct {
+	Limit    int64         // tokens of a key per window across all replicas (default 100).
+	Window   time.Duration // default 1s.
+	Prefix   string        // prefix of the store keys (default "grate:").
+	Batch    int64         // tokens leased per store round trip (default 1, no leasing).
+	FailOpen bool          // allow the requests if the store fails, otherwise the error is returned.
+	Clock    gtime.Clock   // default gtime.RealClock.
+}
+
+// lease is the tokens of key leased in a window, it is refilled by one goroutine at a time,
+// the others wait for the refill instead of calling store.
+type lease struct {
+	mu        sync.Mutex
+	window    int64
+	remaining int64
+	exhausted bool          // the store granted less than Batch, the limit of window is used up
+	refilling chan struct{} // closed when the refill in flight is done
+}
+
+// DistributedLimiter is the fixed window limiter whose counters live in Store,
+// so the limit is shared by all replicas.
+// If Batch > 1, the replica leases a batch of tokens from store and spends them locally,
+// it reduces the store round trips, but the unspent tokens of a lease are lost at the end of window.
+type DistributedLimiter struct {
+	store  Store
+	option DistributedOption
+
+	mu          sync.Mutex // guard leases and sweepWindow, never held during store calls
+	leases      map[string]*lease
+	sweepWindow int64
+}
+
+// NewDistributedLimiter creates a distributed limiter on store.
+func NewDistributedLimiter(store Store, opt ...DistributedOption) *DistributedLimiter {
+	option := DistributedOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Limit <= 0 {
+		option.Limit = 100
+	}
+	if option.Window <= 0 {
+		option.Window = time.Second
+	}
+	if option.Prefix == "" {
+		option.Prefix = "grate:"
+	}
+	if option.Batch <= 0 {
+		option.Batch = 1
+	}
+	if option.Batch > option.Limit {
+		option.Batch = option.Limit
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+
+	return &DistributedLimiter{
+		store:  store,
+		option: option,
+		leases: make(map[string]*lease),
+	}
+}
+
+// Allow implements Limiter, the key is carried by ctx with NewContextWithKey.
+// ErrLimitExceed is returned if the limit is exceeded, the error of store is returned if not FailOpen.
+func (d *DistributedLimiter) Allow(ctx context.Context) (func(Operation), error) {
+	key, _ := KeyFromContext(ctx)
+	ok, err := d.AllowN(ctx, key, 1)
+	if err != nil {
+		return func(Operation) {}, err
+	}
+	if !ok {
+		return func(Operation) {}, ErrLimitExceed
+	}
+	return func(Operation) {}, nil
+}
+
+// AllowN reports whether n tokens of key could be taken in current window.
+func (d *DistributedLimiter) AllowN(ctx context.Context, key string, n int64) (bool, error) {
+	now := d.option.Clock.Now()
+	window := now.UnixNano() / int64(d.option.Window)
+
+	if d.option.Batch == 1 || n > d.option.Batch {
+		return d.take(ctx, key, window, now, n)
+	}
+
+	l := d.getLease(key, window)
+	for {
+		l.mu.Lock()
+		if l.remaining >= n {
+			l.remaining -= n
+			l.mu.Unlock()
+			return true, nil
+		}
+		if l.exhausted {
+			l.mu.Unlock()
+			return false, nil
+		}
+		if ch := l.refilling; ch != nil {
+			l.mu.Unlock()
+			select {
+			case <-ch:
+				continue
+			case <-ctx.Done():
+				return d.option.FailOpen, d.failErr(ctx.Err())
+			}
+		}
+
+		ch := make(chan struct{})
+		l.refilling = ch
+		l.mu.Unlock()
+
+		granted, err := d.lease(ctx, key, window, now)
+
+		l.mu.Lock()
+		l.refilling = nil
+		close(ch)
+		if err != nil {
+			l.mu.Unlock()
+			return d.option.FailOpen, d.failErr(err)
+		}
+		l.remaining += granted
+		l.exhausted = granted < d.option.Batch
+		l.mu.Unlock()
+	}
+}
+
+// getLease returns the lease of key in window, creates it if not exist.
+func (d *DistributedLimiter) getLease(key string, window int64) *lease {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(window)
+	l, ok := d.leases[key]
+	if !ok || l.window != window {
+		l = &lease{window: window}
+		d.leases[key] = l
+	}
+	return l
+}
+
+// take n tokens from store directly.
+func (d *DistributedLimiter) take(ctx context.Context, key string, window int64, now time.Time, n int64) (bool, error) {
+	count, err := d.store.IncrBy(ctx, d.storeKey(key, window), n, d.ttl(window, now))
+	if err != nil {
+		return d.option.FailOpen, d.failErr(err)
+	}
+	return count <= d.option.Limit, nil
+}
+
+// lease a batch of tokens from store, returns the granted tokens which may be less than Batch.
+func (d *DistributedLimiter) lease(ctx context.Context, key string, window int64, now time.Time) (int64, error) {
+	count, err := d.store.IncrBy(ctx, d.storeKey(key, window), d.option.Batch, d.ttl(window, now))
+	if err != nil {
+		return 0, err
+	}
+
+	granted := d.option.Batch
+	if over := count - d.option.Limit; over > 0 {
+		granted -= over
+	}
+	if granted < 0 {
+		granted = 0
+	}
+	return granted, nil
+}
+
+func (d *DistributedLimiter) failErr(err error) error {
+	if d.option.FailOpen {
+		return nil
+	}
+	return err
+}
+
+func (d *DistributedLimiter) storeKey(key string, window int64) string {
+	return d.option.Prefix + key + ":" + strconv.FormatInt(window, 10)
+}
+
+// ttl keeps the store key until the end of window.
+func (d *DistributedLimiter) ttl(window int64, now time.Time) time.Duration {
+	return time.Duration((window+1)*int64(d.option.Window) - now.UnixNano())
+}
+
+// sweep removes the leases of past windows once per window, must hold lock.
+func (d *DistributedLimiter) sweep(window int64) {
+	if window == d.sweepWindow {
+		return
+	}
+	d.sweepWindow = window
+	for k, l := range d.leases {
+		if l.window != window {
+			delete(d.leases, k)
+		}
+	}
+}
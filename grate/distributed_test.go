@@ -0,0 +1,149 @@
+package grate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countStore struct {
+	Store
+	calls int
+	err   error
+}
+
+func (s *countStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	s.calls++
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.Store.IncrBy(ctx, key, n, ttl)
+}
+
+func allowN(t *testing.T, d *DistributedLimiter, key string, n int) (allowed int) {
+	for i := 0; i < n; i++ {
+		ok, err := d.AllowN(context.Background(), key, 1)
+		if err != nil {
+			t.Fatalf("Should not fail, but (%v)", err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	return
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	clock := newManualClock()
+	store := NewMemoryStore(clock)
+	opt := DistributedOption{Limit: 10, Window: time.Second, Clock: clock}
+	d1, d2 := NewDistributedLimiter(store, opt), NewDistributedLimiter(store, opt)
+
+	if allowed := allowN(t, d1, "a", 6) + allowN(t, d2, "a", 6); allowed != 10 {
+		t.Fatalf("Should share limit 10 across replicas, but (%d)", allowed)
+	}
+	if allowed := allowN(t, d1, "b", 1); allowed != 1 {
+		t.Fatalf("Should limit keys separately, but (%d)", allowed)
+	}
+
+	clock.Advance(time.Second)
+	if allowed := allowN(t, d2, "a", 12); allowed != 10 {
+		t.Fatalf("Should reset in next window, but (%d)", allowed)
+	}
+	if n := store.Len(); n != 1 {
+		t.Fatalf("Should expire keys of past window, but (%d)", n)
+	}
+
+	ctx := NewContextWithKey(context.Background(), "a")
+	if _, err := d1.Allow(ctx); err != ErrLimitExceed {
+		t.Fatalf("Should exceed limit, but (%v)", err)
+	}
+}
+
+func TestDistributedLease(t *testing.T) {
+	clock := newManualClock()
+	store := &countStore{Store: NewMemoryStore(clock)}
+	opt := DistributedOption{Limit: 10, Window: time.Second, Batch: 4, Clock: clock}
+	d1, d2 := NewDistributedLimiter(store, opt), NewDistributedLimiter(store, opt)
+
+	if allowed := allowN(t, d1, "a", 8); allowed != 8 || store.calls != 2 {
+		t.Fatalf("Should allow 8 with 2 leases, but (%d, %d)", allowed, store.calls)
+	}
+	// only 2 tokens are left for the lease of d2
+	if allowed := allowN(t, d2, "a", 4); allowed != 2 {
+		t.Fatalf("Should allow the rest of limit, but (%d)", allowed)
+	}
+
+	clock.Advance(time.Second)
+	if allowed := allowN(t, d2, "a", 4); allowed != 4 {
+		t.Fatalf("Should lease in next window, but (%d)", allowed)
+	}
+}
+
+func TestDistributedStoreError(t *testing.T) {
+	store := &countStore{Store: NewMemoryStore(nil), err: errors.New("store down")}
+
+	d := NewDistributedLimiter(store, DistributedOption{Limit: 1})
+	if _, err := d.Allow(context.Background()); err != store.err {
+		t.Fatalf("Should return store error, but (%v)", err)
+	}
+
+	d = NewDistributedLimiter(store, DistributedOption{Limit: 1, Batch: 1, FailOpen: true})
+	if ok, err := d.AllowN(context.Background(), "a", 1); !ok || err != nil {
+		t.Fatalf("Should fail open, but (%v, %v)", ok, err)
+	}
+}
+
+type blockStore struct {
+	Store
+	block chan struct{}
+}
+
+func (s *blockStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if strings.Contains(key, "slow:") {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	return s.Store.IncrBy(ctx, key, n, ttl)
+}
+
+func TestDistributedSlowStore(t *testing.T) {
+	store := &blockStore{Store: NewMemoryStore(nil), block: make(chan struct{})}
+	d := NewDistributedLimiter(store, DistributedOption{Limit: 10, Window: time.Hour, Batch: 4})
+
+	slow := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ok, _ := d.AllowN(context.Background(), "slow", 1)
+			slow <- ok
+		}()
+	}
+
+	// the other keys are not blocked by the refill of slow key
+	done := make(chan int, 1)
+	go func() { done <- allowN(t, d, "fast", 3) }()
+	select {
+	case allowed := <-done:
+		if allowed != 3 {
+			t.Fatalf("Should allow fast key, but (%d)", allowed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Should not be blocked by the slow key")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.AllowN(ctx, "slow", 1); err != context.DeadlineExceeded {
+		t.Fatalf("Should return when ctx is done, but (%v)", err)
+	}
+
+	close(store.block)
+	if !<-slow || !<-slow {
+		t.Fatal("Should share the lease of one refill")
+	}
+}
@@ -0,0 +1,140 @@
+package grate
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// GradientOption gradient config.
+type GradientOption struct {
+	LimitOption
+	Smoothing     float64 `json:"smoothing" yaml:"smoothing"`           // weight of new limit (default 0.2).
+	RTTTolerance  float64 `json:"rtt_tolerance" yaml:"rtt_tolerance"`   // tolerated ratio of rtt to min rtt (default 2).
+	ProbeInterval int64   `json:"probe_interval" yaml:"probe_interval"` // windows to reset min rtt (default 1000).
+}
+
+// Gradient is the concurrency limit adjusted by the gradient of min rtt and current rtt,
+// newLimit = limit * minRTT * tolerance / rtt + sqrt(limit).
+type Gradient struct {
+	limitBase
+	option GradientOption
+	probes int64
+}
+
+// NewGradient creates a gradient concurrency limit.
+func NewGradient(opt ...GradientOption) *Gradient {
+	option := GradientOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Smoothing <= 0 || option.Smoothing > 1 {
+		option.Smoothing = 0.2
+	}
+	if option.RTTTolerance < 1 {
+		option.RTTTolerance = 2
+	}
+	if option.ProbeInterval <= 0 {
+		option.ProbeInterval = 1000
+	}
+
+	g := &Gradient{option: option, probes: option.ProbeInterval}
+	g.init(option.LimitOption, g)
+	return g
+}
+
+func (g *Gradient) update(s *sample, lastRTT int64, limit int64) float64 {
+	g.probes--
+	if g.probes <= 0 {
+		// reset min rtt to follow the change of downstream latency
+		g.probes = g.option.ProbeInterval
+		atomic.StoreInt64(&g.minRTT, lastRTT)
+	}
+
+	if s.Drop() {
+		return float64(limit) / 2
+	}
+
+	gradient := g.option.RTTTolerance * float64(g.minRTT) / float64(lastRTT)
+	return smoothLimit(s, limit, gradient, g.option.Smoothing)
+}
+
+// Gradient2Option gradient2 config.
+type Gradient2Option struct {
+	LimitOption
+	Smoothing    float64 `json:"smoothing" yaml:"smoothing"`         // weight of new limit (default 0.2).
+	RTTTolerance float64 `json:"rtt_tolerance" yaml:"rtt_tolerance"` // tolerated ratio of rtt to long rtt (default 1.5).
+	LongWindow   int64   `json:"long_window" yaml:"long_window"`     // windows of long term rtt average (default 600).
+}
+
+// Gradient2 is the concurrency limit adjusted by the gradient of long term average rtt and current rtt,
+// it is more stable than Gradient when the latency of downstream changes.
+type Gradient2 struct {
+	limitBase
+	option  Gradient2Option
+	longRTT float64
+	windows int64
+}
+
+// NewGradient2 creates a gradient2 concurrency limit.
+func NewGradient2(opt ...Gradient2Option) *Gradient2 {
+	option := Gradient2Option{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Smoothing <= 0 || option.Smoothing > 1 {
+		option.Smoothing = 0.2
+	}
+	if option.RTTTolerance < 1 {
+		option.RTTTolerance = 1.5
+	}
+	if option.LongWindow <= 0 {
+		option.LongWindow = 600
+	}
+
+	g := &Gradient2{option: option}
+	g.init(option.LimitOption, g)
+	return g
+}
+
+func (g *Gradient2) update(s *sample, lastRTT int64, limit int64) float64 {
+	shortRTT := float64(lastRTT)
+	if g.windows < g.option.LongWindow {
+		// simple average in warmup
+		g.windows++
+		g.longRTT += (shortRTT - g.longRTT) / float64(g.windows)
+	} else {
+		factor := 2 / float64(g.option.LongWindow+1)
+		g.longRTT = g.longRTT*(1-factor) + shortRTT*factor
+	}
+
+	// recover quickly from the steady state of high latency
+	if g.longRTT/shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+
+	if s.Drop() {
+		return float64(limit) / 2
+	}
+
+	gradient := g.option.RTTTolerance * g.longRTT / shortRTT
+	return smoothLimit(s, limit, gradient, g.option.Smoothing)
+}
+
+// smoothLimit computes the new limit by gradient, and smooths it with the current limit.
+func smoothLimit(s *sample, limit int64, gradient float64, smoothing float64) float64 {
+	gradient = math.Max(0.5, math.Min(1, gradient))
+	queue := math.Sqrt(float64(limit))
+	newLimit := float64(limit)*gradient + queue
+
+	// do not increase the limit if it is not reached
+	if s.MaxInFlight()*2 < limit && newLimit > float64(limit) {
+		return float64(limit)
+	}
+
+	newLimit = float64(limit)*(1-smoothing) + newLimit*smoothing
+	if newLimit > float64(limit) {
+		// the limit is truncated when stored, round up to make progress on small limit
+		return math.Ceil(newLimit)
+	}
+	return newLimit
+}
@@ -0,0 +1,133 @@
+package grate
+
+import (
+	"net/http"
+
+	"github.com/xtfly/gokits/gnet/ghttp"
+)
+
+// HTTPOption http middleware config.
+type HTTPOption struct {
+	// Classify maps the response status code to the operation reported to limiter,
+	// default Drop for 429 and 5xx, Success for others.
+	Classify func(statusCode int) Operation
+}
+
+func (o *HTTPOption) init() {
+	if o.Classify == nil {
+		o.Classify = classifyStatus
+	}
+}
+
+func classifyStatus(statusCode int) Operation {
+	if statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError {
+		return Drop
+	}
+	return Success
+}
+
+// limitError maps the error of Allow to the error response,
+// ErrLimitExceed to 429 and ErrDeadline to 503.
+func limitError(err error) *ghttp.ErrorResponse {
+	if err == ErrLimitExceed {
+		return ghttp.NewErrorRes(http.StatusTooManyRequests).WithMsg(err.Error())
+	}
+	return ghttp.NewErrorRes(http.StatusServiceUnavailable).WithMsg(err.Error())
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying writer supports it.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware returns a http.Handler that calls l.Allow with the request context before next,
+// the rejected requests are responded with ghttp.ErrorResponse,
+// the accepted requests are reported to l by the response status code.
+func Middleware(l Limiter, next http.Handler, opt ...HTTPOption) http.Handler {
+	option := HTTPOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	option.init()
+
+	return ghttp.WrapperHandler(func(w http.ResponseWriter, r *http.Request) error {
+		done, err := l.Allow(r.Context())
+		if err != nil {
+			return limitError(err)
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				done(Drop)
+				panic(p)
+			}
+			if sw.statusCode == 0 {
+				sw.statusCode = http.StatusOK
+			}
+			done(option.Classify(sw.statusCode))
+		}()
+		next.ServeHTTP(sw, r)
+		return nil
+	})
+}
+
+type transport struct {
+	limiter Limiter
+	base    http.RoundTripper
+	option  HTTPOption
+}
+
+// NewTransport returns a http.RoundTripper that calls l.Allow with the request context before base,
+// if the request is rejected, the error of Allow is returned without sending it.
+// The transport error is reported as Drop, and the response is reported by its status code.
+// The base is http.DefaultTransport if nil.
+func NewTransport(l Limiter, base http.RoundTripper, opt ...HTTPOption) http.RoundTripper {
+	option := HTTPOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	option.init()
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{limiter: l, base: base, option: option}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	done, err := t.limiter.Allow(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := t.base.RoundTrip(r)
+	if err != nil {
+		done(Drop)
+		return nil, err
+	}
+	done(t.option.Classify(rsp.StatusCode))
+	return rsp, nil
+}
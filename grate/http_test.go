@@ -0,0 +1,71 @@
+package grate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordLimiter struct {
+	err error
+	ops []Operation
+}
+
+func (l *recordLimiter) Allow(ctx context.Context) (func(Operation), error) {
+	if l.err != nil {
+		return func(Operation) {}, l.err
+	}
+	return func(op Operation) { l.ops = append(l.ops, op) }, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	l := &recordLimiter{}
+	h := Middleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/ok", "/fail"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if len(l.ops) != 2 || l.ops[0] != Success || l.ops[1] != Drop {
+		t.Fatalf("Should report Success and Drop, but (%v)", l.ops)
+	}
+
+	for err, code := range map[error]int{ErrLimitExceed: http.StatusTooManyRequests, ErrDeadline: http.StatusServiceUnavailable} {
+		l.err = err
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+		if w.Code != code {
+			t.Fatalf("Should respond %d for %v, but (%d)", code, err, w.Code)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	l := &recordLimiter{}
+	client := &http.Client{Transport: NewTransport(l, nil), Timeout: time.Second}
+	rsp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Should get response, but (%v)", err)
+	}
+	rsp.Body.Close()
+	if len(l.ops) != 1 || l.ops[0] != Drop {
+		t.Fatalf("Should report Drop, but (%v)", l.ops)
+	}
+
+	l.err = ErrLimitExceed
+	if _, err = client.Get(srv.URL); err == nil {
+		t.Fatalf("Should be rejected by limiter")
+	}
+}
@@ -0,0 +1,194 @@
+package grate
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+const (
+	minWindowTime = int64(time.Millisecond * 500)
+	maxWindowTime = int64(time.Millisecond * 2000)
+
+	minLimit = 8
+	maxLimit = 2048
+)
+
+// ConcurrencyLimit is the algorithm which decides the max in flight requests.
+type ConcurrencyLimit interface {
+	// Acquire reserves a slot of in flight requests, no matter success or not,
+	// done() must be called at last.
+	Acquire() (done func(time.Time, Operation), success bool)
+
+	// Stats return the statistics of concurrency limit.
+	Stats() LimitStats
+}
+
+// LimitOption is the common config of concurrency limit algorithms.
+type LimitOption struct {
+	InitLimit int64       `json:"init_limit" yaml:"init_limit"` // default MinLimit.
+	MinLimit  int64       `json:"min_limit" yaml:"min_limit"`   // default 8.
+	MaxLimit  int64       `json:"max_limit" yaml:"max_limit"`   // default 2048.
+	Clock     gtime.Clock `json:"-" yaml:"-"`                   // default gtime.RealClock.
+}
+
+// LimitStats is the Statistics of concurrency limit.
+type LimitStats struct {
+	Limit    int64
+	InFlight int64
+	MinRTT   time.Duration
+	LastRTT  time.Duration
+}
+
+// limitUpdater computes the new limit from the sample of a window.
+type limitUpdater interface {
+	// update is called with the lock held once per window, returns the new limit.
+	update(s *sample, lastRTT int64, limit int64) float64
+}
+
+// limitBase collects the samples of requests, and updates the limit once per window.
+type limitBase struct {
+	limit      int64
+	inFlight   int64
+	updateTime int64
+	minRTT     int64
+
+	option  LimitOption
+	sample  atomic.Value
+	mu      sync.Mutex
+	updater limitUpdater
+}
+
+func newLimitOption(opt LimitOption) LimitOption {
+	if opt.MinLimit <= 0 {
+		opt.MinLimit = minLimit
+	}
+	if opt.MaxLimit <= 0 {
+		opt.MaxLimit = maxLimit
+	}
+	if opt.MaxLimit < opt.MinLimit {
+		opt.MaxLimit = opt.MinLimit
+	}
+	if opt.InitLimit < opt.MinLimit {
+		opt.InitLimit = opt.MinLimit
+	}
+	if opt.InitLimit > opt.MaxLimit {
+		opt.InitLimit = opt.MaxLimit
+	}
+	if opt.Clock == nil {
+		opt.Clock = gtime.RealClock
+	}
+	return opt
+}
+
+func (b *limitBase) init(opt LimitOption, updater limitUpdater) {
+	b.option = newLimitOption(opt)
+	b.limit = b.option.InitLimit
+	b.updater = updater
+	b.sample.Store(&sample{})
+}
+
+// Stats return the statistics of concurrency limit.
+func (b *limitBase) Stats() LimitStats {
+	return LimitStats{
+		Limit:    atomic.LoadInt64(&b.limit),
+		InFlight: atomic.LoadInt64(&b.inFlight),
+		MinRTT:   time.Duration(atomic.LoadInt64(&b.minRTT)),
+		LastRTT:  time.Duration(b.sample.Load().(*sample).RTT()),
+	}
+}
+
+// Acquire implements ConcurrencyLimit.
+func (b *limitBase) Acquire() (done func(time.Time, Operation), success bool) {
+	inFlight := atomic.AddInt64(&b.inFlight, 1)
+	if inFlight <= atomic.LoadInt64(&b.limit) {
+		success = true
+	}
+
+	return func(start time.Time, op Operation) {
+		atomic.AddInt64(&b.inFlight, -1)
+		if op == Ignore {
+			return
+		}
+
+		end := b.option.Clock.Now().UnixNano()
+		rtt := end - start.UnixNano()
+
+		s := b.sample.Load().(*sample)
+		b.addToSample(s, rtt, inFlight, op)
+
+		if end > atomic.LoadInt64(&b.updateTime) && s.Count() >= 16 {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			if b.sample.Load().(*sample) != s {
+				return
+			}
+			b.sample.Store(&sample{})
+
+			lastRTT := s.RTT()
+			if lastRTT <= 0 {
+				return
+			}
+
+			b.newUpdateTime(lastRTT, end)
+			if b.minRTT == 0 || lastRTT < b.minRTT {
+				atomic.StoreInt64(&b.minRTT, lastRTT)
+			}
+			b.storeLimit(b.updater.update(s, lastRTT, atomic.LoadInt64(&b.limit)))
+		}
+	}, success
+}
+
+func (b *limitBase) addToSample(s *sample, rtt int64, inFlight int64, op Operation) {
+	if op == Drop {
+		s.Add(rtt, inFlight, true)
+	} else if op == Success {
+		s.Add(rtt, inFlight, false)
+	}
+}
+
+func (b *limitBase) newUpdateTime(lastRTT int64, end int64) {
+	updateTime := end + lastRTT*5
+	if lastRTT*5 < minWindowTime {
+		updateTime = end + minWindowTime
+	} else if lastRTT*5 > maxWindowTime {
+		updateTime = end + maxWindowTime
+	}
+	atomic.StoreInt64(&b.updateTime, updateTime)
+}
+
+func (b *limitBase) storeLimit(newLimit float64) {
+	newLimit = math.Max(float64(b.option.MinLimit), math.Min(float64(b.option.MaxLimit), newLimit))
+	atomic.StoreInt64(&b.limit, int64(newLimit))
+}
+
+// FixedLimit is a concurrency limit with fixed max in flight requests.
+type FixedLimit struct {
+	limit    int64
+	inFlight int64
+}
+
+// NewFixedLimit creates a fixed concurrency limit.
+func NewFixedLimit(limit int64) *FixedLimit {
+	return &FixedLimit{limit: limit}
+}
+
+// Acquire implements ConcurrencyLimit.
+func (f *FixedLimit) Acquire() (done func(time.Time, Operation), success bool) {
+	inFlight := atomic.AddInt64(&f.inFlight, 1)
+	return func(time.Time, Operation) {
+		atomic.AddInt64(&f.inFlight, -1)
+	}, inFlight <= f.limit
+}
+
+// Stats return the statistics of fixed limit.
+func (f *FixedLimit) Stats() LimitStats {
+	return LimitStats{
+		Limit:    f.limit,
+		InFlight: atomic.LoadInt64(&f.inFlight),
+	}
+}
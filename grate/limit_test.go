@@ -0,0 +1,126 @@
+package grate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newSample(rtt time.Duration, inFlight int64, drop bool) *sample {
+	s := &sample{}
+	for i := 0; i < 16; i++ {
+		s.Add(int64(rtt), inFlight, drop)
+	}
+	return s
+}
+
+func TestFixedLimit(t *testing.T) {
+	f := NewFixedLimit(2)
+	done1, ok1 := f.Acquire()
+	done2, ok2 := f.Acquire()
+	done3, ok3 := f.Acquire()
+	if !ok1 || !ok2 || ok3 {
+		t.Fatalf("Should allow 2 in flight, but (%v, %v, %v)", ok1, ok2, ok3)
+	}
+	done1(time.Now(), Success)
+	done2(time.Now(), Success)
+	done3(time.Now(), Ignore)
+	if stats := f.Stats(); stats.Limit != 2 || stats.InFlight != 0 {
+		t.Fatalf("Should have limit 2 and 0 in flight, but (%+v)", stats)
+	}
+}
+
+func TestLimitOption(t *testing.T) {
+	v := NewVegas(VegasOption{LimitOption: LimitOption{InitLimit: 20, MinLimit: 10, MaxLimit: 30}})
+	if limit := v.Stats().Limit; limit != 20 {
+		t.Fatalf("Should start with limit 20, but (%d)", limit)
+	}
+	v.storeLimit(100)
+	if limit := v.Stats().Limit; limit != 30 {
+		t.Fatalf("Should be capped to max limit 30, but (%d)", limit)
+	}
+	v.storeLimit(1)
+	if limit := v.Stats().Limit; limit != 10 {
+		t.Fatalf("Should be capped to min limit 10, but (%d)", limit)
+	}
+
+	a := NewAIMD()
+	if limit := a.Stats().Limit; limit != minLimit {
+		t.Fatalf("Should start with default min limit, but (%d)", limit)
+	}
+}
+
+func TestAIMDUpdate(t *testing.T) {
+	a := NewAIMD(AIMDOption{BackoffRatio: 0.5, Timeout: time.Second})
+
+	if limit := a.update(newSample(time.Millisecond, 20, false), int64(time.Millisecond), 20); limit != 21 {
+		t.Fatalf("Should increase limit by one, but (%v)", limit)
+	}
+	if limit := a.update(newSample(time.Millisecond, 5, false), int64(time.Millisecond), 20); limit != 20 {
+		t.Fatalf("Should keep limit when it is not reached, but (%v)", limit)
+	}
+	if limit := a.update(newSample(time.Millisecond, 20, true), int64(time.Millisecond), 20); limit != 10 {
+		t.Fatalf("Should decrease limit on drop, but (%v)", limit)
+	}
+	if limit := a.update(newSample(2*time.Second, 20, false), int64(2*time.Second), 20); limit != 10 {
+		t.Fatalf("Should decrease limit on timeout, but (%v)", limit)
+	}
+}
+
+func TestGradientUpdate(t *testing.T) {
+	g := NewGradient(GradientOption{Smoothing: 1, RTTTolerance: 1})
+	g.minRTT = int64(10 * time.Millisecond)
+
+	// rtt doubled, the gradient is 0.5
+	limit := g.update(newSample(20*time.Millisecond, 100, false), int64(20*time.Millisecond), 100)
+	if limit != 60 {
+		t.Fatalf("Should decrease limit to 60, but (%v)", limit)
+	}
+
+	// rtt equals min rtt, the limit grows by sqrt(limit)
+	limit = g.update(newSample(10*time.Millisecond, 100, false), int64(10*time.Millisecond), 100)
+	if limit != 110 {
+		t.Fatalf("Should increase limit to 110, but (%v)", limit)
+	}
+
+	if limit = g.update(newSample(10*time.Millisecond, 100, true), int64(10*time.Millisecond), 100); limit != 50 {
+		t.Fatalf("Should halve limit on drop, but (%v)", limit)
+	}
+}
+
+func TestGradient2Update(t *testing.T) {
+	g := NewGradient2(Gradient2Option{Smoothing: 1, RTTTolerance: 1, LongWindow: 10})
+
+	rtt := int64(10 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		g.update(newSample(10*time.Millisecond, 100, false), rtt, 100)
+	}
+	if g.longRTT != float64(rtt) {
+		t.Fatalf("Long rtt should be %v, but (%v)", rtt, g.longRTT)
+	}
+
+	// latency spike, the long rtt moves slowly
+	limit := g.update(newSample(40*time.Millisecond, 100, false), 4*rtt, 100)
+	if limit != 60 {
+		t.Fatalf("Should decrease limit to 60, but (%v)", limit)
+	}
+	if g.longRTT <= float64(rtt) || g.longRTT >= float64(2*rtt) {
+		t.Fatalf("Long rtt should move slowly, but (%v)", g.longRTT)
+	}
+}
+
+func TestLimiterWith(t *testing.T) {
+	l := NewLimiterWith(NewFixedLimit(1), CoDelOption{Target: 20, Internal: 500})
+
+	done, err := l.Allow(context.Background())
+	if err != nil {
+		t.Fatalf("Should be allowed, but (%v)", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Allow(ctx); err != ErrDeadline {
+		t.Fatalf("Should be queued until deadline, but (%v)", err)
+	}
+	done(Success)
+}
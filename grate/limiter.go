@@ -21,19 +21,28 @@ const (
 
 // Limiter limit interface.
 type Limiter interface {
+	// Allow returns done which must be called with the result of request if it is allowed.
+	// The rate based limiters ignore the result, their done does nothing.
 	Allow(ctx context.Context) (func(Operation), error)
 }
 
-// limiter use tcp vegas + codel for adaptive limit.
+// limiter use concurrency limit (tcp vegas by default) + codel for adaptive limit.
 type limiter struct {
-	rate  *Vegas
+	rate  ConcurrencyLimit
 	queue *CoDel
 }
 
 // NewLimiter returns a new Limiter that allows events up to adaptive rtt.
 func NewLimiter(c ...CoDelOption) Limiter {
+	return NewLimiterWith(NewVegas(), c...)
+}
+
+// NewLimiterWith returns a new Limiter that allows events up to the given concurrency limit,
+// the exceeded requests are buffered in CoDel queue.
+// The rtt of requests is measured by the Clock of CoDelOption, it should be the same as the one of rate.
+func NewLimiterWith(rate ConcurrencyLimit, c ...CoDelOption) Limiter {
 	l := &limiter{
-		rate:  NewVegas(),
+		rate:  rate,
 		queue: NewCoDel(c...),
 	}
 
@@ -57,7 +66,7 @@ func (l *limiter) Allow(ctx context.Context) (func(op Operation), error) {
 		}
 	}
 
-	start := time.Now()
+	start := l.queue.option.Clock.Now()
 	return func(op Operation) {
 		done(start, op)
 		l.queue.Pop()
@@ -1,51 +1,40 @@
 package grate
 
 import (
-	"context"
 	"testing"
 	"time"
 )
 
+// simulateFailed replays the requests at qps to a server handles them one by one at serverQPS
+// through the limiter, returns the requests rejected, dropped or expired.
+func simulateFailed(qps, serverQPS float64) (failed int64) {
+	rtt := CapacityRTT(time.Duration(float64(time.Second)/serverQPS), 1)
+	trace := Simulate(SimulationOption{Seed: 1, Step: time.Second, Phases: []LoadPhase{
+		{Duration: 10 * time.Second, Rate: qps, Regular: true, RTT: rtt},
+	}})
+	for _, p := range trace {
+		failed += p.Rejected + p.Dropped + p.Expired
+	}
+	return
+}
+
 func TestRateSuccess(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(100, ch)
-	failed := producerL(NewLimiter(), 100, ch)
+	failed := simulateFailed(100, 100)
 	if failed > 0 {
 		t.Fatalf("Should be rejected 0 time,but (%d)", failed)
 	}
 }
 
 func TestRateFail(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(100, ch)
-	failed := producerL(NewLimiter(), 200, ch)
+	failed := simulateFailed(200, 100)
 	if failed < 900 {
 		t.Fatalf("Should be rejected more than 900 times,but (%d)", failed)
 	}
 }
 
 func TestRateFailMuch(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(10, ch)
-	failed := producerL(NewLimiter(), 200, ch)
+	failed := simulateFailed(200, 10)
 	if failed < 1600 {
 		t.Fatalf("Should be rejected more than 1600 times,but (%d)", failed)
 	}
 }
-
-func producerL(l Limiter, qps int64, ch chan struct{}) (failed int) {
-	for i := 0; i < int(qps)*10; i++ {
-		go func() {
-			done, err := l.Allow(context.Background())
-			if err != nil {
-				failed++
-				return
-			}
-
-			defer done(Success)
-			ch <- struct{}{}
-		}()
-		time.Sleep(time.Duration(int64(time.Second) / qps))
-	}
-	return
-}
@@ -0,0 +1,157 @@
+package grate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// RegistryOption limiter registry config.
+type RegistryOption struct {
+	CoDel       CoDelOption             // template config of the CoDel queue of each limiter.
+	NewLimit    func() ConcurrencyLimit // creates the concurrency limit of each limiter (default NewVegas with Clock).
+	IdleTimeout time.Duration           // the limiter of a key is removed after idle for it (default 10 minutes).
+	Clock       gtime.Clock             // default gtime.RealClock.
+}
+
+// LimiterStats is the Statistics of a adaptive limiter.
+type LimiterStats struct {
+	Vegas VegasStats
+	CoDel CoDelStats
+}
+
+// RegistryStats is the Statistics of all limiters in registry.
+type RegistryStats struct {
+	Limiters    map[string]LimiterStats
+	InFlight    int64 // total in flight requests of all limiters
+	Packets     int   // total queued requests of all limiters
+	DroppingNum int   // number of limiters whose queue is in drop state
+}
+
+type registryEntry struct {
+	limiter  *limiter
+	lastSeen time.Time
+}
+
+// Registry holds a adaptive limiter per key, e.g. downstream endpoint or tenant,
+// the limiters are created lazily from the template config and removed after idle.
+type Registry struct {
+	option    RegistryOption
+	mu        sync.Mutex
+	entries   map[string]*registryEntry
+	lastSweep time.Time
+}
+
+// NewRegistry creates a limiter registry.
+func NewRegistry(opt ...RegistryOption) *Registry {
+	option := RegistryOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+	if option.CoDel.Target <= 0 {
+		option.CoDel.Target = 50
+	}
+	if option.CoDel.Internal <= 0 {
+		option.CoDel.Internal = 500
+	}
+	if option.NewLimit == nil {
+		clock := option.Clock
+		option.NewLimit = func() ConcurrencyLimit {
+			return NewVegas(VegasOption{LimitOption: LimitOption{Clock: clock}})
+		}
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = 10 * time.Minute
+	}
+	if option.CoDel.Clock == nil {
+		option.CoDel.Clock = option.Clock
+	}
+
+	return &Registry{
+		option:  option,
+		entries: make(map[string]*registryEntry),
+	}
+}
+
+// Get returns the limiter of key, creates it if not exist.
+func (r *Registry) Get(key string) Limiter {
+	return r.get(key)
+}
+
+// Allow implements Limiter, the key is carried by ctx with NewContextWithKey.
+func (r *Registry) Allow(ctx context.Context) (func(Operation), error) {
+	key, _ := KeyFromContext(ctx)
+	return r.get(key).Allow(ctx)
+}
+
+// Len returns the number of limiters in registry.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Evict removes the limiters which are idle for IdleTimeout and have no request in flight.
+// The idle limiters are also evicted lazily when the registry is used.
+func (r *Registry) Evict() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastSweep = time.Time{}
+	r.sweep(r.option.Clock.Now())
+}
+
+// Stats return the statistics of all limiters in registry.
+func (r *Registry) Stats() RegistryStats {
+	r.mu.Lock()
+	entries := make(map[string]*limiter, len(r.entries))
+	for k, e := range r.entries {
+		entries[k] = e.limiter
+	}
+	r.mu.Unlock()
+
+	stats := RegistryStats{Limiters: make(map[string]LimiterStats, len(entries))}
+	for k, l := range entries {
+		vs, cs := l.Stats()
+		stats.Limiters[k] = LimiterStats{Vegas: vs, CoDel: cs}
+		stats.InFlight += vs.InFlight
+		stats.Packets += cs.Packets
+		if cs.Dropping {
+			stats.DroppingNum++
+		}
+	}
+	return stats
+}
+
+func (r *Registry) get(key string) *limiter {
+	now := r.option.Clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+	e, ok := r.entries[key]
+	if !ok {
+		e = &registryEntry{limiter: NewLimiterWith(r.option.NewLimit(), r.option.CoDel).(*limiter)}
+		r.entries[key] = e
+	}
+	e.lastSeen = now
+	return e.limiter
+}
+
+// sweep removes the idle limiters at most once per IdleTimeout, must hold lock.
+func (r *Registry) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.option.IdleTimeout {
+		return
+	}
+	r.lastSweep = now
+	for k, e := range r.entries {
+		if now.Sub(e.lastSeen) >= r.option.IdleTimeout && e.limiter.rate.Stats().InFlight == 0 {
+			delete(r.entries, k)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package grate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRegistryGet(t *testing.T) {
+	r := NewRegistry()
+
+	l1 := r.Get("endpoint1")
+	if l1 != r.Get("endpoint1") {
+		t.Fatalf("Should return the same limiter for the same key")
+	}
+	if l1 == r.Get("endpoint2") {
+		t.Fatalf("Should return different limiters for different keys")
+	}
+	if n := r.Len(); n != 2 {
+		t.Fatalf("Should have 2 limiters, but (%d)", n)
+	}
+}
+
+func TestRegistryCoDelDefaults(t *testing.T) {
+	r := NewRegistry(RegistryOption{CoDel: CoDelOption{Target: 20}})
+	if r.option.CoDel.Target != 20 || r.option.CoDel.Internal != 500 {
+		t.Fatalf("Should keep Target and default Internal, but (%d, %d)", r.option.CoDel.Target, r.option.CoDel.Internal)
+	}
+	r = NewRegistry(RegistryOption{CoDel: CoDelOption{Internal: 200}})
+	if r.option.CoDel.Target != 50 || r.option.CoDel.Internal != 200 {
+		t.Fatalf("Should keep Internal and default Target, but (%d, %d)", r.option.CoDel.Target, r.option.CoDel.Internal)
+	}
+}
+
+func TestRegistryStats(t *testing.T) {
+	r := NewRegistry()
+
+	done1, err := r.Allow(NewContextWithKey(context.Background(), "tenant1"))
+	if err != nil {
+		t.Fatalf("Should be allowed, but (%v)", err)
+	}
+	done2, _ := r.Allow(NewContextWithKey(context.Background(), "tenant2"))
+	done3, _ := r.Allow(NewContextWithKey(context.Background(), "tenant2"))
+
+	stats := r.Stats()
+	if len(stats.Limiters) != 2 || stats.InFlight != 3 {
+		t.Fatalf("Should have 2 limiters and 3 in flight, but (%d, %d)", len(stats.Limiters), stats.InFlight)
+	}
+	if inFlight := stats.Limiters["tenant2"].Vegas.InFlight; inFlight != 2 {
+		t.Fatalf("Should have 2 in flight of tenant2, but (%d)", inFlight)
+	}
+
+	done1(Success)
+	done2(Success)
+	done3(Ignore)
+	if inFlight := r.Stats().InFlight; inFlight != 0 {
+		t.Fatalf("Should have 0 in flight, but (%d)", inFlight)
+	}
+}
+
+func TestRegistryEvict(t *testing.T) {
+	clock := newManualClock()
+	r := NewRegistry(RegistryOption{IdleTimeout: time.Minute, Clock: clock})
+
+	r.Get("idle")
+	done, _ := r.Get("busy").Allow(context.Background())
+	clock.Advance(30 * time.Second)
+	r.Get("active")
+
+	clock.Advance(30 * time.Second)
+	r.Evict()
+	if n := r.Len(); n != 2 {
+		t.Fatalf("Should keep the active and busy limiters, but (%d)", n)
+	}
+
+	done(Success)
+	clock.Advance(time.Minute)
+	r.Get("new")
+	if n := r.Len(); n != 1 {
+		t.Fatalf("Should evict idle limiters lazily, but (%d)", n)
+	}
+}
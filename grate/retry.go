@@ -0,0 +1,224 @@
+package grate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gnet"
+	"github.com/xtfly/gokits/gtime"
+)
+
+// BudgetOption retry budget config.
+type BudgetOption struct {
+	Ratio      float64       // retries allowed per successful call (default 0.1).
+	MinRetries int64         // retries always allowed in window for the low traffic (default 10, negative for none).
+	Window     time.Duration // sliding window of the calls (default 10s).
+	Buckets    int           // buckets of the sliding window (default 10).
+	Clock      gtime.Clock   // default gtime.RealClock.
+}
+
+// BudgetStats is the Statistics of retry budget.
+type BudgetStats struct {
+	Successes int64 // successful calls in window
+	Retries   int64 // retries in window
+	Available int64 // retries could be withdrawn
+}
+
+type budgetBucket struct {
+	start     time.Time
+	successes int64
+	retries   int64
+}
+
+// RetryBudget limits the retries to a ratio of the successful calls over a sliding window,
+// so the retries can not amplify the load much during outages.
+type RetryBudget struct {
+	option  BudgetOption
+	width   time.Duration
+	mu      sync.Mutex
+	buckets []budgetBucket
+}
+
+// NewRetryBudget creates a retry budget.
+func NewRetryBudget(opt ...BudgetOption) *RetryBudget {
+	option := BudgetOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Ratio <= 0 {
+		option.Ratio = 0.1
+	}
+	if option.MinRetries < 0 {
+		option.MinRetries = 0
+	} else if option.MinRetries == 0 {
+		option.MinRetries = 10
+	}
+	if option.Window <= 0 {
+		option.Window = 10 * time.Second
+	}
+	if option.Buckets <= 0 {
+		option.Buckets = 10
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+
+	return &RetryBudget{
+		option:  option,
+		width:   option.Window / time.Duration(option.Buckets),
+		buckets: make([]budgetBucket, option.Buckets),
+	}
+}
+
+// Deposit records a successful call.
+func (b *RetryBudget) Deposit() {
+	now := b.option.Clock.Now()
+
+	b.mu.Lock()
+	b.bucket(now).successes++
+	b.mu.Unlock()
+}
+
+// Withdraw takes a retry from budget, returns false if the budget is exhausted.
+func (b *RetryBudget) Withdraw() bool {
+	now := b.option.Clock.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stats(now).Available <= 0 {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// Stats return the statistics of retry budget.
+func (b *RetryBudget) Stats() BudgetStats {
+	now := b.option.Clock.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats(now)
+}
+
+// stats counts the calls in window, must hold lock.
+func (b *RetryBudget) stats(now time.Time) (s BudgetStats) {
+	for i := range b.buckets {
+		bucket := &b.buckets[i]
+		if now.Sub(bucket.start) >= b.option.Window {
+			continue
+		}
+		s.Successes += bucket.successes
+		s.Retries += bucket.retries
+	}
+	s.Available = b.option.MinRetries + int64(b.option.Ratio*float64(s.Successes)) - s.Retries
+	if s.Available < 0 {
+		s.Available = 0
+	}
+	return
+}
+
+// bucket returns the bucket of now, resets it if expired, must hold lock.
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	start := now.Truncate(b.width)
+	// the index is negative before 1970
+	n := int64(len(b.buckets))
+	bucket := &b.buckets[((start.UnixNano()/int64(b.width))%n+n)%n]
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+	return bucket
+}
+
+// RetryOption retry config.
+type RetryOption struct {
+	Backoff     gnet.Backoff     // delay before each retry (default gnet.DefaultBackoff).
+	MaxAttempts int              // max calls include the first one (default 3).
+	Budget      *RetryBudget     // nil is unlimited.
+	Retryable   func(error) bool // default all errors except the errors of ctx and limiter.
+	Limiter     Limiter          // each attempt is allowed by and reported to it if not nil.
+	Clock       gtime.Clock      // waits the delay before retry (default gtime.RealClock).
+	// OnRetry is called before waiting for the retry.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func defaultRetryable(err error) bool {
+	switch err {
+	case context.Canceled, context.DeadlineExceeded, ErrLimitExceed, ErrDeadline:
+		return false
+	}
+	return true
+}
+
+// Retry calls f until it succeeds, the error is not retryable, MaxAttempts is reached,
+// the budget is exhausted or ctx is done, and returns the last error of f.
+// If Limiter is set, the attempt rejected by it is not retried and its error is returned,
+// the attempt is reported as Drop if f returns a retryable error, otherwise as Success.
+func Retry(ctx context.Context, f func(ctx context.Context) error, opt ...RetryOption) error {
+	option := RetryOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Backoff == nil {
+		backoff := gnet.DefaultBackoff
+		option.Backoff = &backoff
+	}
+	if option.MaxAttempts <= 0 {
+		option.MaxAttempts = 3
+	}
+	if option.Retryable == nil {
+		option.Retryable = defaultRetryable
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+
+	for attempt := 1; ; attempt++ {
+		allowed, err := attemptOnce(ctx, f, &option)
+		if err == nil {
+			if option.Budget != nil {
+				option.Budget.Deposit()
+			}
+			return nil
+		}
+
+		if !allowed || attempt >= option.MaxAttempts || !option.Retryable(err) {
+			return err
+		}
+		if option.Budget != nil && !option.Budget.Withdraw() {
+			return err
+		}
+
+		delay := option.Backoff.Backoff(attempt - 1)
+		if option.OnRetry != nil {
+			option.OnRetry(attempt, err, delay)
+		}
+		t := option.Clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C():
+		}
+	}
+}
+
+// attemptOnce calls f once, returns false if the attempt is rejected by limiter.
+func attemptOnce(ctx context.Context, f func(ctx context.Context) error, option *RetryOption) (allowed bool, err error) {
+	if option.Limiter == nil {
+		return true, f(ctx)
+	}
+
+	done, err := option.Limiter.Allow(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err = f(ctx); err != nil && option.Retryable(err) {
+		done(Drop)
+	} else {
+		done(Success)
+	}
+	return true, err
+}
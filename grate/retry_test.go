@@ -0,0 +1,137 @@
+package grate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xtfly/gokits/gnet"
+	"github.com/xtfly/gokits/gtime"
+)
+
+var errRetry = errors.New("retry")
+
+func failTimes(n int) (func(context.Context) error, *int) {
+	calls := new(int)
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return errRetry
+		}
+		return nil
+	}, calls
+}
+
+func TestRetry(t *testing.T) {
+	backoff := &gnet.BackoffConfig{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Factor: 1}
+	l := &recordLimiter{}
+
+	f, calls := failTimes(2)
+	if err := Retry(context.Background(), f, RetryOption{Backoff: backoff, Limiter: l}); err != nil || *calls != 3 {
+		t.Fatalf("Should succeed at 3rd attempt, but (%v, %d)", err, *calls)
+	}
+	if len(l.ops) != 3 || l.ops[0] != Drop || l.ops[1] != Drop || l.ops[2] != Success {
+		t.Fatalf("Should report 2 drops and a success, but (%v)", l.ops)
+	}
+
+	f, calls = failTimes(5)
+	if err := Retry(context.Background(), f, RetryOption{Backoff: backoff, MaxAttempts: 2}); err != errRetry || *calls != 2 {
+		t.Fatalf("Should stop at max attempts, but (%v, %d)", err, *calls)
+	}
+
+	f, calls = failTimes(5)
+	notRetryable := func(error) bool { return false }
+	if err := Retry(context.Background(), f, RetryOption{Backoff: backoff, Retryable: notRetryable}); err != errRetry || *calls != 1 {
+		t.Fatalf("Should not retry, but (%v, %d)", err, *calls)
+	}
+
+	f, calls = failTimes(5)
+	l.err = ErrLimitExceed
+	if err := Retry(context.Background(), f, RetryOption{Backoff: backoff, Limiter: l}); err != ErrLimitExceed || *calls != 0 {
+		t.Fatalf("Should be rejected by limiter, but (%v, %d)", err, *calls)
+	}
+
+	f, calls = failTimes(5)
+	retries := 0
+	err := Retry(context.Background(), f, RetryOption{
+		Backoff:   backoff,
+		Limiter:   l,
+		Retryable: func(error) bool { return true },
+		OnRetry:   func(int, error, time.Duration) { retries++ },
+	})
+	if err != ErrLimitExceed || *calls != 0 || retries != 0 {
+		t.Fatalf("Should not retry the rejected attempt with custom Retryable, but (%v, %d, %d)", err, *calls, retries)
+	}
+}
+
+func TestRetryClock(t *testing.T) {
+	clock := newManualClock()
+	f, calls := failTimes(1)
+	result := make(chan error, 1)
+	go func() {
+		result <- Retry(context.Background(), f, RetryOption{
+			Backoff: &gnet.BackoffConfig{BaseDelay: time.Hour, MaxDelay: time.Hour, Factor: 1},
+			Clock:   clock,
+		})
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	if err := <-result; err != nil || *calls != 2 {
+		t.Fatalf("Should retry after the delay of clock, but (%v, %d)", err, *calls)
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f, calls := failTimes(5)
+	err := Retry(ctx, f, RetryOption{
+		Backoff: &gnet.BackoffConfig{BaseDelay: time.Hour, MaxDelay: time.Hour, Factor: 1},
+		OnRetry: func(int, error, time.Duration) { cancel() },
+	})
+	if err != errRetry || *calls != 1 {
+		t.Fatalf("Should stop when ctx is done, but (%v, %d)", err, *calls)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	clock := newManualClock()
+	b := NewRetryBudget(BudgetOption{Ratio: 0.5, MinRetries: 1, Window: 10 * time.Second, Clock: clock})
+
+	for i := 0; i < 4; i++ {
+		b.Deposit()
+	}
+	withdrawn := 0
+	for b.Withdraw() {
+		withdrawn++
+	}
+	if withdrawn != 3 {
+		t.Fatalf("Should allow 1 + 4 * 0.5 retries, but (%d)", withdrawn)
+	}
+
+	clock.Advance(10 * time.Second)
+	if stats := b.Stats(); stats.Successes != 0 || stats.Available != 1 {
+		t.Fatalf("Should slide out the old calls, but (%+v)", stats)
+	}
+
+	f, calls := failTimes(5)
+	backoff := &gnet.BackoffConfig{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Factor: 1}
+	if err := Retry(context.Background(), f, RetryOption{Backoff: backoff, MaxAttempts: 5, Budget: b}); err != errRetry || *calls != 2 {
+		t.Fatalf("Should stop when budget is exhausted, but (%v, %d)", err, *calls)
+	}
+}
+
+func TestRetryBudgetClock(t *testing.T) {
+	for _, start := range []time.Time{{}, time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		clock := gtime.NewFakeClock(start)
+		b := NewRetryBudget(BudgetOption{Ratio: 1, MinRetries: -1, Clock: clock})
+		for i := 0; i < 10; i++ {
+			b.Deposit()
+			clock.Advance(900 * time.Millisecond)
+		}
+		if stats := b.Stats(); stats.Successes != 10 || stats.Available != 10 {
+			t.Fatalf("Should count the calls at %v, but (%+v)", start, stats)
+		}
+	}
+}
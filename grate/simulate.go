@@ -0,0 +1,302 @@
+package grate
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+// RTTFunc returns the rtt of a request, running is the requests being handled when it starts.
+type RTTFunc func(r *rand.Rand, running int64) time.Duration
+
+// ConstantRTT returns a RTTFunc of fixed rtt.
+func ConstantRTT(rtt time.Duration) RTTFunc {
+	return func(*rand.Rand, int64) time.Duration {
+		return rtt
+	}
+}
+
+// UniformRTT returns a RTTFunc of rtt uniformly distributed in [min, max).
+func UniformRTT(min, max time.Duration) RTTFunc {
+	return func(r *rand.Rand, _ int64) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// ExponentialRTT returns a RTTFunc of rtt exponentially distributed with mean.
+func ExponentialRTT(mean time.Duration) RTTFunc {
+	return func(r *rand.Rand, _ int64) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// CapacityRTT returns a RTTFunc of a server which handles capacity requests concurrently in base rtt,
+// the rtt grows linearly with the running requests when it is overloaded.
+func CapacityRTT(base time.Duration, capacity int64) RTTFunc {
+	return func(_ *rand.Rand, running int64) time.Duration {
+		if running <= capacity {
+			return base
+		}
+		return time.Duration(float64(base) * float64(running) / float64(capacity))
+	}
+}
+
+// LoadPhase is a period of synthetic load.
+type LoadPhase struct {
+	Duration time.Duration
+	Rate     float64 // poisson arrivals per second
+	Regular  bool    // arrive at the fixed interval 1/Rate instead of poisson
+	RTT      RTTFunc // default ConstantRTT(10ms)
+}
+
+// SimulationOption simulation config.
+type SimulationOption struct {
+	NewLimit     func(clock gtime.Clock) ConcurrencyLimit // creates the limit with the simulated clock (default NewVegas).
+	CoDel        CoDelOption                              // config of CoDel queue, the Clock is replaced.
+	Phases       []LoadPhase                              // the load replayed in order.
+	QueueTimeout time.Duration                            // deadline of queued requests (default 1s).
+	DropRTT      time.Duration                            // the request is reported as Drop if its rtt reaches it (default 0, disabled).
+	Tick         time.Duration                            // resolution of the simulated clock (default 1ms).
+	Step         time.Duration                            // interval of trace points (default the larger of 100ms and Tick).
+	Seed         int64                                    // seed of arrivals and rtt.
+}
+
+// TracePoint is the state of limiter at the end of a step, the counters are of the step.
+type TracePoint struct {
+	Time      time.Duration // since the start of simulation
+	Limit     int64
+	InFlight  int64 // in flight requests of limit, include the queued
+	Queued    int
+	Arrivals  int64
+	Completed int64
+	Rejected  int64         // rejected by full queue
+	Dropped   int64         // dropped by CoDel
+	Expired   int64         // expired in queue
+	RTT       time.Duration // mean rtt of completed requests
+}
+
+// Trace is the result of simulation.
+type Trace []TracePoint
+
+// WriteCSV writes the trace as csv with header.
+func (t Trace) WriteCSV(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "time_ms,limit,in_flight,queued,arrivals,completed,rejected,dropped,expired,rtt_ms"); err != nil {
+		return err
+	}
+	for _, p := range t {
+		if _, err := fmt.Fprintf(w, "%d,%d,%d,%d,%d,%d,%d,%d,%d,%.3f\n",
+			p.Time/time.Millisecond, p.Limit, p.InFlight, p.Queued, p.Arrivals, p.Completed,
+			p.Rejected, p.Dropped, p.Expired, float64(p.RTT)/float64(time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type simRequest struct {
+	done     func(time.Time, Operation)
+	start    time.Time
+	end      time.Time
+	packet   queuePacket
+	deadline time.Time
+}
+
+type simHeap []*simRequest
+
+func (h simHeap) Len() int            { return len(h) }
+func (h simHeap) Less(i, j int) bool  { return h[i].end.Before(h[j].end) }
+func (h simHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *simHeap) Push(x interface{}) { *h = append(*h, x.(*simRequest)) }
+func (h *simHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+type simulation struct {
+	option  SimulationOption
+	clock   *gtime.FakeClock
+	rnd     *rand.Rand
+	limit   ConcurrencyLimit
+	codel   *CoDel
+	running simHeap
+	queue   []*simRequest
+	phase   LoadPhase
+	point   TracePoint
+	rttSum  time.Duration
+}
+
+// Simulate replays the synthetic load through the concurrency limit and CoDel queue
+// in the same way as the limiter of NewLimiterWith, with a simulated clock.
+// The requests never block, so the trace is reproducible with the same option.
+func Simulate(opt SimulationOption) Trace {
+	if opt.NewLimit == nil {
+		opt.NewLimit = func(clock gtime.Clock) ConcurrencyLimit {
+			return NewVegas(VegasOption{LimitOption: LimitOption{Clock: clock}})
+		}
+	}
+	if opt.QueueTimeout <= 0 {
+		opt.QueueTimeout = time.Second
+	}
+	if opt.Tick <= 0 {
+		opt.Tick = time.Millisecond
+	}
+	if opt.Step <= 0 {
+		opt.Step = 100 * time.Millisecond
+	}
+	if opt.Step < opt.Tick {
+		opt.Step = opt.Tick
+	}
+
+	clock := gtime.NewFakeClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	codelOpt := opt.CoDel
+	if codelOpt.Target <= 0 || codelOpt.Internal <= 0 {
+		codelOpt.Target, codelOpt.Internal = 50, 500
+	}
+	codelOpt.Clock = clock
+
+	s := &simulation{
+		option: opt,
+		clock:  clock,
+		rnd:    rand.New(rand.NewSource(opt.Seed)),
+		limit:  opt.NewLimit(clock),
+		codel:  NewCoDel(codelOpt),
+	}
+	return s.run()
+}
+
+func (s *simulation) run() Trace {
+	var (
+		trace    Trace
+		elapsed  time.Duration
+		nextStep = s.option.Step
+	)
+	for _, phase := range s.option.Phases {
+		s.phase = phase
+		if s.phase.RTT == nil {
+			s.phase.RTT = ConstantRTT(10 * time.Millisecond)
+		}
+
+		end := elapsed + phase.Duration
+		next := elapsed + s.interval()
+		for elapsed < end {
+			elapsed += s.option.Tick
+			s.clock.Advance(s.option.Tick)
+
+			s.complete()
+			s.expire()
+			for ; next <= elapsed; next += s.interval() {
+				s.arrive()
+			}
+
+			// the point is at the first tick reaching the step, when Step is not a multiple of Tick
+			if elapsed >= nextStep {
+				trace = append(trace, s.snapshot(elapsed))
+				for nextStep <= elapsed {
+					nextStep += s.option.Step
+				}
+			}
+		}
+	}
+	return trace
+}
+
+// interval returns the next inter-arrival time of current phase.
+func (s *simulation) interval() time.Duration {
+	if s.phase.Rate <= 0 {
+		return s.phase.Duration + s.option.Tick
+	}
+	if s.phase.Regular {
+		return time.Duration(float64(time.Second) / s.phase.Rate)
+	}
+	return time.Duration(s.rnd.ExpFloat64() / s.phase.Rate * float64(time.Second))
+}
+
+func (s *simulation) arrive() {
+	s.point.Arrivals++
+	done, ok := s.limit.Acquire()
+	if ok {
+		s.start(done)
+		return
+	}
+
+	if len(s.queue) >= s.codel.option.Capacity {
+		s.point.Rejected++
+		done(time.Time{}, Ignore)
+		return
+	}
+	s.queue = append(s.queue, &simRequest{
+		done:     done,
+		packet:   queuePacket{timestamp: s.codel.now(), criticality: Critical},
+		deadline: s.clock.Now().Add(s.option.QueueTimeout),
+	})
+}
+
+func (s *simulation) start(done func(time.Time, Operation)) {
+	now := s.clock.Now()
+	rtt := s.phase.RTT(s.rnd, int64(len(s.running))+1)
+	heap.Push(&s.running, &simRequest{done: done, start: now, end: now.Add(rtt)})
+}
+
+func (s *simulation) complete() {
+	for len(s.running) > 0 && !s.running[0].end.After(s.clock.Now()) {
+		r := heap.Pop(&s.running).(*simRequest)
+		rtt := s.clock.Now().Sub(r.start)
+		op := Success
+		if s.option.DropRTT > 0 && rtt >= s.option.DropRTT {
+			op = Drop
+		}
+		r.done(r.start, op)
+		s.point.Completed++
+		s.rttSum += rtt
+		s.pop()
+	}
+}
+
+// pop is the same as CoDel.Pop, the first req not dropped is started.
+func (s *simulation) pop() {
+	for len(s.queue) > 0 {
+		r := s.queue[0]
+		s.queue = s.queue[1:]
+		if s.codel.judge(r.packet) {
+			s.codel.drops[r.packet.criticality]++
+			s.point.Dropped++
+			r.done(time.Time{}, Ignore)
+			continue
+		}
+		s.start(r.done)
+		return
+	}
+}
+
+func (s *simulation) expire() {
+	for len(s.queue) > 0 && !s.queue[0].deadline.After(s.clock.Now()) {
+		s.queue[0].done(time.Time{}, Ignore)
+		s.queue = s.queue[1:]
+		s.point.Expired++
+	}
+}
+
+func (s *simulation) snapshot(elapsed time.Duration) TracePoint {
+	stats := s.limit.Stats()
+	p := s.point
+	p.Time = elapsed
+	p.Limit = stats.Limit
+	p.InFlight = stats.InFlight
+	p.Queued = len(s.queue)
+	if p.Completed > 0 {
+		p.RTT = s.rttSum / time.Duration(p.Completed)
+	}
+
+	s.point = TracePoint{}
+	s.rttSum = 0
+	return p
+}
@@ -0,0 +1,56 @@
+package grate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func simulateOverload() Trace {
+	rtt := CapacityRTT(10*time.Millisecond, 50)
+	return Simulate(SimulationOption{Seed: 1, Step: time.Second, Phases: []LoadPhase{
+		{Duration: 10 * time.Second, Rate: 2000, RTT: rtt},
+		{Duration: 10 * time.Second, Rate: 20000, RTT: rtt},
+		{Duration: 5 * time.Second, Rate: 2000, RTT: rtt},
+	}})
+}
+
+func TestSimulateDeterministic(t *testing.T) {
+	var b1, b2 bytes.Buffer
+	if err := simulateOverload().WriteCSV(&b1); err != nil {
+		t.Fatalf("Should write csv, but (%v)", err)
+	}
+	_ = simulateOverload().WriteCSV(&b2)
+	if b1.String() != b2.String() {
+		t.Fatalf("Should be reproducible, but\n%s\n%s", b1.String(), b2.String())
+	}
+	if lines := strings.Count(b1.String(), "\n"); lines != 26 {
+		t.Fatalf("Should have header and 25 points, but (%d)", lines)
+	}
+}
+
+func TestSimulateOverload(t *testing.T) {
+	trace := simulateOverload()
+
+	warm, overload, recovered := trace[9], trace[19], trace[24]
+	if warm.Dropped+warm.Rejected+warm.Expired != 0 || warm.Queued != 0 {
+		t.Fatalf("Should handle all requests before overload, but (%+v)", warm)
+	}
+	if overload.Dropped == 0 || overload.Limit >= warm.Limit {
+		t.Fatalf("Should drop requests and decrease limit on overload, but (%+v)", overload)
+	}
+	if recovered.Dropped+recovered.Rejected+recovered.Expired != 0 || recovered.Queued != 0 {
+		t.Fatalf("Should recover after overload, but (%+v)", recovered)
+	}
+}
+
+func TestSimulateStep(t *testing.T) {
+	phases := []LoadPhase{{Duration: time.Second, Rate: 100}}
+	if trace := Simulate(SimulationOption{Tick: 3 * time.Millisecond, Step: 100 * time.Millisecond, Phases: phases}); len(trace) != 10 {
+		t.Fatalf("Should have a point per step when Step is not a multiple of Tick, but (%d)", len(trace))
+	}
+	if trace := Simulate(SimulationOption{Tick: 200 * time.Millisecond, Phases: phases}); len(trace) != 5 {
+		t.Fatalf("Should have a point per tick when Tick is larger than 100ms, but (%d)", len(trace))
+	}
+}
@@ -5,53 +5,61 @@ import (
 	"time"
 )
 
-func worker(qps int64, ch chan struct{}) {
-	for {
-		<-ch
-		time.Sleep(time.Duration(int64(time.Second) / qps))
+type vegasCall struct {
+	start, end time.Time
+	done       func(time.Time, Operation)
+}
+
+// producer sends the requests at qps with a manual clock to a server handles them one by one
+// at serverQPS, returns the requests rejected by vegas.
+func producer(qps, serverQPS int64) (failed int) {
+	clock := newManualClock()
+	v := NewVegas(VegasOption{LimitOption: LimitOption{Clock: clock}})
+	interval, service := time.Second/time.Duration(qps), time.Second/time.Duration(serverQPS)
+
+	var running []vegasCall
+	begin, free := clock.Now(), clock.Now()
+	for i := 0; i < int(qps)*10; i++ {
+		at := begin.Add(time.Duration(i) * interval)
+		for len(running) > 0 && !running[0].end.After(at) {
+			clock.Advance(running[0].end.Sub(clock.Now()))
+			running[0].done(running[0].start, Success)
+			running = running[1:]
+		}
+		clock.Advance(at.Sub(clock.Now()))
+
+		done, success := v.Acquire()
+		if !success {
+			failed++
+			done(at, Success)
+			continue
+		}
+		if free.Before(at) {
+			free = at
+		}
+		free = free.Add(service)
+		running = append(running, vegasCall{start: at, end: free, done: done})
 	}
+	return
 }
 
 func TestVegasRateSuccess(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(100, ch)
-	failed := producer(NewVegas(), 100, ch)
+	failed := producer(100, 100)
 	if failed > 0 {
 		t.Fatalf("Should be rejected 0 time,but (%d)", failed)
 	}
 }
 
 func TestVegasRateFail(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(100, ch)
-	failed := producer(NewVegas(), 200, ch)
+	failed := producer(200, 100)
 	if failed < 900 {
 		t.Fatalf("Should be rejected more than 900 times,but (%d)", failed)
 	}
 }
 
 func TestVegasRateFailMuch(t *testing.T) {
-	ch := make(chan struct{})
-	go worker(10, ch)
-	failed := producer(NewVegas(), 200, ch)
+	failed := producer(200, 10)
 	if failed < 1600 {
 		t.Fatalf("Should be rejected more than 1600 times,but (%d)", failed)
 	}
 }
-
-func producer(v *Vegas, qps int64, ch chan struct{}) (failed int) {
-	for i := 0; i < int(qps)*10; i++ {
-		go func() {
-			start := time.Now()
-			done, success := v.Acquire()
-			defer done(start, Success)
-			if success {
-				ch <- struct{}{}
-			} else {
-				failed++
-			}
-		}()
-		time.Sleep(time.Duration(int64(time.Second) / qps))
-	}
-	return
-}
@@ -0,0 +1,291 @@
+package grate
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+const windowBuckets = 64
+
+type keyCtx struct{}
+
+// NewContextWithKey returns a new context that carries the limit key,
+// which is used by the keyed limiters in Allow.
+func NewContextWithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtx{}, key)
+}
+
+// KeyFromContext returns the limit key carried by ctx.
+func KeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(keyCtx{}).(string)
+	return key, ok
+}
+
+// WindowOption window limiter config.
+type WindowOption struct {
+	Limit       int64         // max events per window of a key (default 100).
+	Window      time.Duration // window size (default 1 second).
+	IdleTimeout time.Duration // the state of a key is evicted after idle for it (default 2 windows).
+	Clock       gtime.Clock   // default gtime.RealClock.
+}
+
+// windowCounter counts the events of a key.
+type windowCounter interface {
+	// allow takes n events if the count would not exceed limit
+	allow(now time.Time, n, limit int64, window time.Duration) bool
+	// count return the events counted in window
+	count(now time.Time, window time.Duration) int64
+}
+
+type windowEntry struct {
+	counter  windowCounter
+	lastSeen time.Time
+}
+
+type windowBucket struct {
+	mu        sync.Mutex
+	entries   map[string]*windowEntry
+	lastSweep time.Time
+}
+
+// WindowLimiter limits the events of each key in a time window.
+type WindowLimiter struct {
+	option     WindowOption
+	newCounter func() windowCounter
+	buckets    []*windowBucket
+}
+
+// NewFixedWindow creates a keyed limiter which counts events in fixed windows,
+// it may allow up to 2*Limit events around the boundary of windows.
+func NewFixedWindow(opt ...WindowOption) *WindowLimiter {
+	return newWindowLimiter(func() windowCounter { return &fixedWindow{} }, opt...)
+}
+
+// NewSlidingWindow creates a keyed limiter which estimates the events in the sliding window
+// by weighting the count of previous fixed window, it uses constant memory per key.
+func NewSlidingWindow(opt ...WindowOption) *WindowLimiter {
+	return newWindowLimiter(func() windowCounter { return &slidingWindow{} }, opt...)
+}
+
+// NewSlidingLog creates a keyed limiter which logs the time of every event in the sliding window,
+// it is accurate and uses memory proportional to Limit per key.
+func NewSlidingLog(opt ...WindowOption) *WindowLimiter {
+	return newWindowLimiter(func() windowCounter { return &slidingLog{} }, opt...)
+}
+
+func newWindowLimiter(newCounter func() windowCounter, opt ...WindowOption) *WindowLimiter {
+	option := WindowOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Limit <= 0 {
+		option.Limit = 100
+	}
+	if option.Window <= 0 {
+		option.Window = time.Second
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = 2 * option.Window
+	}
+	if option.Clock == nil {
+		option.Clock = gtime.RealClock
+	}
+
+	l := &WindowLimiter{
+		option:     option,
+		newCounter: newCounter,
+		buckets:    make([]*windowBucket, windowBuckets),
+	}
+	for i := range l.buckets {
+		l.buckets[i] = &windowBucket{entries: make(map[string]*windowEntry)}
+	}
+	return l
+}
+
+// Allow implements Limiter, the key is carried by ctx with NewContextWithKey,
+// returns ErrLimitExceed if the limit of key is exceeded.
+func (l *WindowLimiter) Allow(ctx context.Context) (func(Operation), error) {
+	key, _ := KeyFromContext(ctx)
+	if !l.AllowN(key, 1) {
+		return func(Operation) {}, ErrLimitExceed
+	}
+	return func(Operation) {}, nil
+}
+
+// AllowKey reports whether a event of key is allowed now.
+func (l *WindowLimiter) AllowKey(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+// AllowN reports whether n events of key are allowed now, and counts them if so.
+func (l *WindowLimiter) AllowN(key string, n int64) bool {
+	now := l.option.Clock.Now()
+	b := l.bucket(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l.sweep(b, now)
+	e, ok := b.entries[key]
+	if !ok {
+		e = &windowEntry{counter: l.newCounter()}
+		b.entries[key] = e
+	}
+	e.lastSeen = now
+	return e.counter.allow(now, n, l.option.Limit, l.option.Window)
+}
+
+// Remaining returns the number of events of key allowed in the current window.
+func (l *WindowLimiter) Remaining(key string) int64 {
+	now := l.option.Clock.Now()
+	b := l.bucket(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return l.option.Limit
+	}
+	remaining := l.option.Limit - e.counter.count(now, l.option.Window)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// KeyNum returns the number of keys tracked, include the idle keys not evicted yet.
+func (l *WindowLimiter) KeyNum() int {
+	n := 0
+	for _, b := range l.buckets {
+		b.mu.Lock()
+		n += len(b.entries)
+		b.mu.Unlock()
+	}
+	return n
+}
+
+// Evict removes the state of keys which are idle for IdleTimeout.
+// The idle keys are also evicted lazily when the limiter is used.
+func (l *WindowLimiter) Evict() {
+	now := l.option.Clock.Now()
+	for _, b := range l.buckets {
+		b.mu.Lock()
+		b.lastSweep = time.Time{}
+		l.sweep(b, now)
+		b.mu.Unlock()
+	}
+}
+
+func (l *WindowLimiter) bucket(key string) *windowBucket {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return l.buckets[h.Sum32()%windowBuckets]
+}
+
+// sweep removes the idle keys of bucket at most once per IdleTimeout, must hold lock.
+func (l *WindowLimiter) sweep(b *windowBucket, now time.Time) {
+	if now.Sub(b.lastSweep) < l.option.IdleTimeout {
+		return
+	}
+	b.lastSweep = now
+	for k, e := range b.entries {
+		if now.Sub(e.lastSeen) >= l.option.IdleTimeout {
+			delete(b.entries, k)
+		}
+	}
+}
+
+// fixedWindow counts events in the window which starts at a multiple of window size.
+type fixedWindow struct {
+	start time.Time
+	n     int64
+}
+
+func (w *fixedWindow) roll(now time.Time, window time.Duration) {
+	start := now.Truncate(window)
+	if !start.Equal(w.start) {
+		w.start = start
+		w.n = 0
+	}
+}
+
+func (w *fixedWindow) allow(now time.Time, n, limit int64, window time.Duration) bool {
+	w.roll(now, window)
+	if w.n+n > limit {
+		return false
+	}
+	w.n += n
+	return true
+}
+
+func (w *fixedWindow) count(now time.Time, window time.Duration) int64 {
+	w.roll(now, window)
+	return w.n
+}
+
+// slidingWindow estimates the events in sliding window with current and previous fixed windows.
+type slidingWindow struct {
+	start time.Time
+	cur   int64
+	prev  int64
+}
+
+func (w *slidingWindow) roll(now time.Time, window time.Duration) {
+	start := now.Truncate(window)
+	switch {
+	case start.Equal(w.start):
+		return
+	case start.Sub(w.start) == window:
+		w.prev = w.cur
+	default:
+		w.prev = 0
+	}
+	w.start = start
+	w.cur = 0
+}
+
+func (w *slidingWindow) count(now time.Time, window time.Duration) int64 {
+	w.roll(now, window)
+	weight := 1 - float64(now.Sub(w.start))/float64(window)
+	return int64(float64(w.prev)*weight) + w.cur
+}
+
+func (w *slidingWindow) allow(now time.Time, n, limit int64, window time.Duration) bool {
+	if w.count(now, window)+n > limit {
+		return false
+	}
+	w.cur += n
+	return true
+}
+
+// slidingLog logs the time of events in sliding window.
+type slidingLog struct {
+	times []time.Time
+}
+
+func (w *slidingLog) count(now time.Time, window time.Duration) int64 {
+	boundary := now.Add(-window)
+	idx := 0
+	for idx < len(w.times) && !w.times[idx].After(boundary) {
+		idx++
+	}
+	if idx > 0 {
+		w.times = append(w.times[:0], w.times[idx:]...)
+	}
+	return int64(len(w.times))
+}
+
+func (w *slidingLog) allow(now time.Time, n, limit int64, window time.Duration) bool {
+	if w.count(now, window)+n > limit {
+		return false
+	}
+	for i := int64(0); i < n; i++ {
+		w.times = append(w.times, now)
+	}
+	return true
+}
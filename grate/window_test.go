@@ -0,0 +1,126 @@
+package grate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtfly/gokits/gtime"
+)
+
+func newManualClock() *gtime.FakeClock {
+	return gtime.NewFakeClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func allowTimes(l *WindowLimiter, key string, n int) (allowed int) {
+	for i := 0; i < n; i++ {
+		if l.AllowKey(key) {
+			allowed++
+		}
+	}
+	return
+}
+
+func TestFixedWindow(t *testing.T) {
+	clock := newManualClock()
+	l := NewFixedWindow(WindowOption{Limit: 10, Window: time.Minute, Clock: clock})
+
+	if allowed := allowTimes(l, "user1", 20); allowed != 10 {
+		t.Fatalf("Should be allowed 10 times, but (%d)", allowed)
+	}
+	if allowed := allowTimes(l, "user2", 5); allowed != 5 {
+		t.Fatalf("Other key should be allowed 5 times, but (%d)", allowed)
+	}
+	if remaining := l.Remaining("user2"); remaining != 5 {
+		t.Fatalf("Remaining should be 5, but (%d)", remaining)
+	}
+
+	clock.Advance(time.Minute)
+	if allowed := allowTimes(l, "user1", 20); allowed != 10 {
+		t.Fatalf("Should be allowed 10 times in next window, but (%d)", allowed)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := newManualClock()
+	l := NewSlidingWindow(WindowOption{Limit: 100, Window: time.Minute, Clock: clock})
+
+	clock.Advance(30 * time.Second)
+	if allowed := allowTimes(l, "user", 150); allowed != 100 {
+		t.Fatalf("Should be allowed 100 times, but (%d)", allowed)
+	}
+
+	// a quarter of next window passed, previous window weights 75%
+	clock.Advance(45 * time.Second)
+	if allowed := allowTimes(l, "user", 100); allowed != 25 {
+		t.Fatalf("Should be allowed 25 times, but (%d)", allowed)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if remaining := l.Remaining("user"); remaining != 100 {
+		t.Fatalf("Remaining should be 100 after idle windows, but (%d)", remaining)
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	clock := newManualClock()
+	l := NewSlidingLog(WindowOption{Limit: 3, Window: time.Minute, Clock: clock})
+
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			clock.Advance(20 * time.Second)
+		}
+		if !l.AllowKey("user") {
+			t.Fatalf("Event %d should be allowed", i)
+		}
+	}
+	if l.AllowKey("user") {
+		t.Fatalf("Should be rejected when the log is full")
+	}
+
+	// the first event slides out of window
+	clock.Advance(20 * time.Second)
+	if !l.AllowKey("user") {
+		t.Fatalf("Should be allowed after the first event slides out")
+	}
+	if l.AllowN("user", 2) {
+		t.Fatalf("Should be rejected when n exceeds remaining")
+	}
+}
+
+func TestWindowEvict(t *testing.T) {
+	clock := newManualClock()
+	l := NewSlidingLog(WindowOption{Limit: 3, Window: time.Minute, IdleTimeout: 5 * time.Minute, Clock: clock})
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.AllowKey(key)
+	}
+	clock.Advance(4 * time.Minute)
+	l.AllowKey("c")
+	clock.Advance(time.Minute)
+	l.Evict()
+	if n := l.KeyNum(); n != 1 {
+		t.Fatalf("Should keep 1 active key, but (%d)", n)
+	}
+
+	clock.Advance(5 * time.Minute)
+	l.Evict()
+	if n := l.KeyNum(); n != 0 {
+		t.Fatalf("Should evict all idle keys, but (%d)", n)
+	}
+}
+
+func TestWindowAllowContext(t *testing.T) {
+	l := NewFixedWindow(WindowOption{Limit: 1, Window: time.Hour, Clock: newManualClock()})
+	ctx := NewContextWithKey(context.Background(), "tenant")
+
+	if _, err := l.Allow(ctx); err != nil {
+		t.Fatalf("Should be allowed, but (%v)", err)
+	}
+	if _, err := l.Allow(ctx); err != ErrLimitExceed {
+		t.Fatalf("Should be rejected, but (%v)", err)
+	}
+	if _, err := l.Allow(NewContextWithKey(context.Background(), "other")); err != nil {
+		t.Fatalf("Other key should be allowed, but (%v)", err)
+	}
+}
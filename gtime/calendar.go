@@ -0,0 +1,205 @@
+package gtime
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// StartOfDay returns the midnight of the day of t in loc, loc is the location of t if nil
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = inLocation(t, loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay returns the last nanosecond of the day of t in loc
+func EndOfDay(t time.Time, loc *time.Location) time.Time {
+	start := StartOfDay(t, loc)
+	return time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location()).Add(-time.Nanosecond)
+}
+
+// StartOfWeek returns the midnight of the first day of the week of t in loc, the week starts at weekStart
+func StartOfWeek(t time.Time, loc *time.Location, weekStart time.Weekday) time.Time {
+	start := StartOfDay(t, loc)
+	offset := (int(start.Weekday()) - int(weekStart) + 7) % 7
+	return time.Date(start.Year(), start.Month(), start.Day()-offset, 0, 0, 0, 0, start.Location())
+}
+
+// EndOfWeek returns the last nanosecond of the week of t in loc, the week starts at weekStart
+func EndOfWeek(t time.Time, loc *time.Location, weekStart time.Weekday) time.Time {
+	start := StartOfWeek(t, loc, weekStart)
+	return time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, start.Location()).Add(-time.Nanosecond)
+}
+
+// StartOfMonth returns the midnight of the first day of the month of t in loc
+func StartOfMonth(t time.Time, loc *time.Location) time.Time {
+	t = inLocation(t, loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfMonth returns the last nanosecond of the month of t in loc
+func EndOfMonth(t time.Time, loc *time.Location) time.Time {
+	start := StartOfMonth(t, loc)
+	return start.AddDate(0, 1, 0).Add(-time.Nanosecond)
+}
+
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if loc != nil {
+		return t.In(loc)
+	}
+	return t
+}
+
+// CalendarOption is the configuration of Calendar
+type CalendarOption struct {
+	Location *time.Location `json:"-" yaml:"-"`             // the dates are in the location, default time.Local
+	Weekend  []time.Weekday `json:"weekend" yaml:"weekend"` // default Saturday and Sunday, invalid days are ignored
+	Holidays []time.Time    `json:"holidays" yaml:"holidays"`
+}
+
+// Calendar decides the business days by the weekend and the holidays
+type Calendar struct {
+	lock     sync.RWMutex
+	loc      *time.Location
+	weekend  [7]bool
+	holidays map[string]struct{}
+}
+
+// NewCalendar creates a calendar with given options
+func NewCalendar(opt ...CalendarOption) *Calendar {
+	c := &Calendar{loc: time.Local, holidays: make(map[string]struct{})}
+	c.weekend[time.Saturday] = true
+	c.weekend[time.Sunday] = true
+
+	if len(opt) >= 1 {
+		if opt[0].Location != nil {
+			c.loc = opt[0].Location
+		}
+		if opt[0].Weekend != nil {
+			c.weekend = [7]bool{}
+			for _, day := range opt[0].Weekend {
+				if day >= time.Sunday && day <= time.Saturday {
+					c.weekend[day] = true
+				}
+			}
+		}
+		for _, day := range opt[0].Holidays {
+			c.AddHoliday(day)
+		}
+	}
+	return c
+}
+
+// LoadCalendar creates a calendar with the holidays in the file, one date as 2006-01-02 per line,
+// the text after the date is the name of holiday and ignored, the lines start with # are comments
+func LoadCalendar(path string, opt ...CalendarOption) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewCalendar(opt...)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		day, err := time.ParseInLocation(dateLayout, fields[0], c.loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday at line %d of %s: %v", line, path, err)
+		}
+		c.AddHoliday(day)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AddHoliday marks the date of t in the location of calendar as a holiday
+func (c *Calendar) AddHoliday(t time.Time) {
+	c.lock.Lock()
+	c.holidays[t.In(c.loc).Format(dateLayout)] = struct{}{}
+	c.lock.Unlock()
+}
+
+// IsHoliday reports whether the date of t is a holiday
+func (c *Calendar) IsHoliday(t time.Time) bool {
+	c.lock.RLock()
+	_, ok := c.holidays[t.In(c.loc).Format(dateLayout)]
+	c.lock.RUnlock()
+	return ok
+}
+
+// IsBusinessDay reports whether the date of t is neither weekend nor holiday
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	return !c.weekend[t.In(c.loc).Weekday()] && !c.IsHoliday(t)
+}
+
+// AddBusinessDays moves t by n business days and keeps the clock time, n could be negative.
+// If n is 0, t is moved to the following business day if it is not a business day
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	t = t.In(c.loc)
+	if !c.hasBusinessDay() {
+		return t
+	}
+	if n == 0 {
+		for !c.IsBusinessDay(t) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if c.IsBusinessDay(t) {
+			n--
+		}
+	}
+	return t
+}
+
+// NextBusinessDay returns the first business day after the date of t, with the same clock time
+func (c *Calendar) NextBusinessDay(t time.Time) time.Time {
+	return c.AddBusinessDays(t, 1)
+}
+
+// BusinessDaysBetween counts the business days from the date of start to the date before end,
+// it is negative if end is before start
+func (c *Calendar) BusinessDaysBetween(start, end time.Time) int {
+	from, to := StartOfDay(start, c.loc), StartOfDay(end, c.loc)
+	sign := 1
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+
+	count := 0
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		if c.IsBusinessDay(d) {
+			count++
+		}
+	}
+	return sign * count
+}
+
+// hasBusinessDay reports whether there is any weekday not in weekend, the holidays are finite
+func (c *Calendar) hasBusinessDay() bool {
+	for _, weekend := range c.weekend {
+		if !weekend {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package gtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartEndOf(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2019-03-13 is a Wednesday, the DST starts at 2019-03-10
+	now := time.Date(2019, 3, 13, 3, 30, 0, 0, time.UTC)
+
+	if d := StartOfDay(now, loc); !d.Equal(time.Date(2019, 3, 12, 0, 0, 0, 0, loc)) {
+		t.Errorf("Should be the midnight of 03-12 in New York, but (%v)", d)
+	}
+	if d := EndOfDay(now, time.UTC); !d.Equal(time.Date(2019, 3, 13, 23, 59, 59, 999999999, time.UTC)) {
+		t.Errorf("Should be the end of 03-13, but (%v)", d)
+	}
+	if d := StartOfWeek(now, loc, time.Monday); !d.Equal(time.Date(2019, 3, 11, 0, 0, 0, 0, loc)) {
+		t.Errorf("Should be Monday 03-11, but (%v)", d)
+	}
+	if d := StartOfWeek(now, loc, time.Sunday); !d.Equal(time.Date(2019, 3, 10, 0, 0, 0, 0, loc)) {
+		t.Errorf("Should be Sunday 03-10, but (%v)", d)
+	}
+	if d := EndOfWeek(now, loc, time.Sunday); !d.Equal(time.Date(2019, 3, 17, 0, 0, 0, 0, loc).Add(-time.Nanosecond)) {
+		t.Errorf("Should be the end of Saturday 03-16, but (%v)", d)
+	}
+	if d := StartOfMonth(now, loc); !d.Equal(time.Date(2019, 3, 1, 0, 0, 0, 0, loc)) {
+		t.Errorf("Should be 03-01, but (%v)", d)
+	}
+	if d := EndOfMonth(time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC), nil); !d.Equal(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)) {
+		t.Errorf("Should be the end of 02-29, but (%v)", d)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "holidays.txt")
+	ioutil.WriteFile(path, []byte("# 2019\n2019-12-25 Christmas\n\n2020-01-01 New Year\n"), 0644)
+
+	c, err := LoadCalendar(path, CalendarOption{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2019-12-24 is a Tuesday
+	eve := time.Date(2019, 12, 24, 10, 0, 0, 0, time.UTC)
+	if !c.IsBusinessDay(eve) || c.IsBusinessDay(eve.AddDate(0, 0, 1)) || c.IsBusinessDay(eve.AddDate(0, 0, 4)) {
+		t.Fatal("Should skip the holiday and weekend")
+	}
+	if d := c.AddBusinessDays(eve, 5); !d.Equal(time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Should be 2020-01-02, but (%v)", d)
+	}
+	if d := c.AddBusinessDays(time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC), -5); !d.Equal(eve) {
+		t.Errorf("Should be back to 2019-12-24, but (%v)", d)
+	}
+	if d := c.AddBusinessDays(eve.AddDate(0, 0, 4), 0); !d.Equal(time.Date(2019, 12, 30, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Should move Saturday to Monday, but (%v)", d)
+	}
+	if n := c.BusinessDaysBetween(eve, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)); n != 5 {
+		t.Errorf("Should be 5 business days, but (%d)", n)
+	}
+	if n := c.BusinessDaysBetween(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), eve); n != -5 {
+		t.Errorf("Should be -5 business days, but (%d)", n)
+	}
+
+	// the invalid days of weekend are ignored
+	c = NewCalendar(CalendarOption{Location: time.UTC, Weekend: []time.Weekday{time.Friday, 7, -1}})
+	if c.IsBusinessDay(eve.AddDate(0, 0, 3)) || !c.IsBusinessDay(eve.AddDate(0, 0, 4)) {
+		t.Error("Should only take Friday as weekend")
+	}
+
+	ioutil.WriteFile(path, []byte("2019-13-01\n"), 0644)
+	if _, err := LoadCalendar(path); err == nil {
+		t.Error("Should fail with invalid date")
+	}
+}
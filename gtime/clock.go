@@ -0,0 +1,199 @@
+package gtime
+
+import (
+	"sync"
+	"time"
+)
+
+// Ticker delivers ticks on C like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// ClockTimer delivers a single event on C like time.Timer
+type ClockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Clock is the source of time, it could be replaced by FakeClock in tests.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) ClockTimer
+}
+
+type realClock struct{}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+// RealClock is the Clock of wall time
+var RealClock Clock = realClock{}
+
+// Now implements Clock
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker implements Clock
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// NewTimer implements Clock
+func (realClock) NewTimer(d time.Duration) ClockTimer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// FakeClock is the Clock driven manually by Advance, the tickers and timers fire
+// in order of their deadlines when the time passes them
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters map[*fakeWaiter]struct{}
+}
+
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration // 0 for timer
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a fake clock start at the given time
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start, waiters: make(map[*fakeWaiter]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker implements Clock
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.newWaiter(d, d)}
+}
+
+// NewTimer implements Clock
+func (c *FakeClock) NewTimer(d time.Duration) ClockTimer {
+	return c.newWaiter(d, 0)
+}
+
+func (c *FakeClock) newWaiter(d, period time.Duration) *fakeWaiter {
+	w := &fakeWaiter{clock: c, period: period, ch: make(chan time.Time, 1)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.deadline = c.now.Add(d)
+	if d <= 0 {
+		w.ch <- c.now
+		return w
+	}
+	c.waiters[w] = struct{}{}
+	c.cond.Broadcast()
+	return w
+}
+
+// Advance moves the time forward by d, and fires the tickers and timers expired,
+// the tick is dropped if the previous one is not received like time.Ticker
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		var next *fakeWaiter
+		for w := range c.waiters {
+			if !w.deadline.After(target) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		c.now = next.deadline
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			delete(c.waiters, next)
+		}
+	}
+	c.now = target
+}
+
+// WaiterCount returns the number of active tickers and timers
+func (c *FakeClock) WaiterCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until there are at least n active tickers and timers,
+// it is used to wait for the goroutine under test to wait on the clock
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, ok := w.clock.waiters[w]
+	delete(w.clock.waiters, w)
+	return ok
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, ok := w.clock.waiters[w]
+	w.deadline = w.clock.now.Add(d)
+	w.clock.waiters[w] = struct{}{}
+	w.clock.cond.Broadcast()
+	return ok
+}
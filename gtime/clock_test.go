@@ -0,0 +1,97 @@
+package gtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	ticker := c.NewTicker(time.Second)
+	timer := c.NewTimer(1500 * time.Millisecond)
+
+	c.Advance(time.Second)
+	if now := <-ticker.C(); !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("Should tick at 1s, but (%v)", now)
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("Timer should not fire before 1.5s")
+	default:
+	}
+
+	c.Advance(time.Second)
+	if now := <-timer.C(); !now.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Fatalf("Should fire at 1.5s, but (%v)", now)
+	}
+	<-ticker.C()
+	if c.WaiterCount() != 1 || timer.Stop() {
+		t.Fatalf("Timer should be expired, but (%d)", c.WaiterCount())
+	}
+
+	// the ticks are dropped if not received
+	c.Advance(3 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("Should drop the ticks not received")
+	default:
+	}
+
+	ticker.Stop()
+	if c.WaiterCount() != 0 || !c.Now().Equal(start.Add(5*time.Second)) {
+		t.Fatalf("Should stop ticker at 5s, but (%d, %v)", c.WaiterCount(), c.Now())
+	}
+}
+
+func TestTimerWheelAdvance(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8})
+
+	fired := 0
+	wheel.AfterFunc(25*time.Millisecond, 3, func() { fired++ })
+	wheel.Advance(25 * time.Millisecond)
+	if fired != 0 {
+		t.Fatalf("Should not fire before 30ms, but (%d)", fired)
+	}
+	wheel.Advance(5 * time.Millisecond)
+	if fired != 1 {
+		t.Fatalf("Should fire at 30ms, but (%d)", fired)
+	}
+	wheel.Advance(time.Second)
+	if fired != 3 {
+		t.Fatalf("Should fire 3 times, but (%d)", fired)
+	}
+}
+
+func TestTimerWheelFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Clock: clock})
+	wheel.Start()
+	defer wheel.Stop()
+
+	ch, _, _ := wheel.After(10*time.Millisecond, 1)
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("Should fire when fake clock advanced")
+	}
+}
+
+func TestCronFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2019, 1, 1, 0, 0, 30, 0, time.UTC))
+	runs := make(chan struct{}, 10)
+	c := NewCron(CronOption{Clock: clock, Location: time.UTC})
+	c.AddFunc("* * * * *", func() { runs <- struct{}{} })
+	c.Start()
+	defer c.Stop()
+
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	<-runs
+	if entries := c.Entries(); !entries[0].Prev.Equal(time.Date(2019, 1, 1, 0, 1, 0, 0, time.UTC)) {
+		t.Fatalf("Should run at 00:01, but (%v)", entries[0].Prev)
+	}
+}
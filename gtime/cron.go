@@ -0,0 +1,641 @@
+package gtime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule decides the activation times of a cron job
+type Schedule interface {
+	// Next returns the next activation time after t, zero time if there is no one
+	Next(t time.Time) time.Time
+}
+
+// cronField is the range of a field in cron expression
+type cronField struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	secondField = cronField{0, 59, nil}
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// specSchedule is the schedule of cron expression, each field is a bit set
+type specSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+	loc                                   *time.Location
+}
+
+// everySchedule is the schedule of fixed interval
+type everySchedule struct {
+	interval time.Duration
+}
+
+// ParseCron parses the cron expression with 5 fields (minute hour day-of-month month day-of-week),
+// 6 fields with the leading second, or the descriptors: @yearly, @annually, @monthly, @weekly,
+// @daily, @midnight, @hourly and "@every <duration>".
+// The time zone could be specified by prefix "CRON_TZ=<zone> " or "TZ=<zone> ", otherwise loc is used,
+// the loc is time.Local if nil
+func ParseCron(spec string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("cron: missing expression after time zone: %s", spec)
+		}
+		zone := spec[strings.IndexByte(spec, '=')+1 : i]
+		var err error
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("cron: invalid time zone %s: %v", zone, err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("cron: invalid interval: %s", spec)
+		}
+		return everySchedule{interval: d}, nil
+	}
+	if s, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = s
+	} else if strings.HasPrefix(spec, "@") {
+		return nil, fmt.Errorf("cron: unknown descriptor: %s", spec)
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron: expected 5 or 6 fields, found %d: %s", len(fields), spec)
+	}
+
+	s := &specSchedule{loc: loc}
+	var err error
+	if s.second, err = parseCronField(fields[0], secondField); err != nil {
+		return nil, err
+	}
+	if s.minute, err = parseCronField(fields[1], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[2], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[3], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[4], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[5], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[3] == "*" || fields[3] == "?"
+	s.dowStar = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of "*", "?", "a", "a-b", with optional "/step"
+func parseCronField(field string, r cronField) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		rangeExpr, step := expr, uint(1)
+		if i := strings.IndexByte(expr, '/'); i >= 0 {
+			n, err := strconv.ParseUint(expr[i+1:], 10, 0)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("cron: invalid step: %s", expr)
+			}
+			rangeExpr, step = expr[:i], uint(n)
+		}
+
+		var start, end uint
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			start, end = r.min, r.max
+		case strings.IndexByte(rangeExpr, '-') > 0:
+			i := strings.IndexByte(rangeExpr, '-')
+			var err error
+			if start, err = parseCronValue(rangeExpr[:i], r); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(rangeExpr[i+1:], r); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangeExpr, r); err != nil {
+				return 0, err
+			}
+			end = start
+			if strings.IndexByte(expr, '/') >= 0 {
+				end = r.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("cron: invalid range: %s", expr)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, r cronField) (uint, error) {
+	if v, ok := r.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 0)
+	if err != nil || uint(v) < r.min || uint(v) > r.max {
+		return 0, fmt.Errorf("cron: value %s out of range [%d, %d]", s, r.min, r.max)
+	}
+	return uint(v), nil
+}
+
+// Next implements Schedule. The fields match the wall clock of the location, each matching
+// wall clock time activates once across the daylight saving time changes:
+// the repeated wall clock time activates at its first occurrence only, and the wall clock time
+// skipped by the change is moved forward by the length of the gap, e.g. 02:30 activates at 03:30
+// when the clock jumps from 02:00 to 03:00
+func (s *specSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.loc)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	for {
+		if wall = s.nextWall(wall); wall.IsZero() {
+			return wall
+		}
+		// skip the second occurrence of the repeated wall clock time
+		if next := wallTime(wall, s.loc); next.After(t) {
+			return next.In(origLoc)
+		}
+	}
+}
+
+// nextWall returns the next matching wall clock time after t, the wall clock is represented in UTC
+func (s *specSchedule) nextWall(t time.Time) time.Time {
+	loc := time.UTC
+	// start from the next second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+
+	// the expression never matches if no time is found in 5 years, e.g. Feb 30
+	yearLimit := t.Year() + 5
+	added := false
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t
+}
+
+// wallTime returns the first instant of the wall clock time in loc, the wall clock time
+// in the gap of daylight saving time is moved forward by the length of gap
+func wallTime(wall time.Time, loc *time.Location) time.Time {
+	// the offsets of zone around the wall clock time, there is at most one change in a day
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	first := wall.Add(-time.Duration(before) * time.Second).In(loc)
+	second := wall.Add(-time.Duration(after) * time.Second).In(loc)
+	if second.Before(first) {
+		first, second = second, first
+	}
+
+	for _, t := range []time.Time{first, second} {
+		if t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Day() == wall.Day() {
+			return t
+		}
+	}
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// dayMatches follows the cron convention: if both day-of-month and day-of-week are restricted,
+// the day matches either of them
+func (s *specSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next implements Schedule
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// OverlapPolicy decides what to do if the job is still running when it is activated again
+type OverlapPolicy int
+
+const (
+	// OverlapAllow runs the job concurrently
+	OverlapAllow OverlapPolicy = iota
+	// OverlapSkip skips the activation
+	OverlapSkip
+	// OverlapQueue runs the job again after the running one finishes
+	OverlapQueue
+)
+
+// Executor runs the cron jobs, e.g. gconcurrent.CronExecutor adapts a WorkerPool
+type Executor interface {
+	Execute(f func())
+}
+
+// TryExecutor is the Executor which could reject the jobs, e.g. gconcurrent.CronExecutor
+// rejects the jobs after its pool is shutdown
+type TryExecutor interface {
+	Executor
+	TryExecute(f func()) error
+}
+
+// ExecutorFunc adapts a function to Executor
+type ExecutorFunc func(f func())
+
+// Execute implements Executor
+func (e ExecutorFunc) Execute(f func()) {
+	e(f)
+}
+
+// CronOption is the configuration of Cron
+type CronOption struct {
+	Location *time.Location // time zone of the expressions without CRON_TZ, default time.Local
+	Executor Executor       // runs the jobs, default a new goroutine per job
+	Overlap  OverlapPolicy  // default policy of jobs, default OverlapAllow
+	Clock    Clock          // default RealClock
+	// PanicFunc process the panic of jobs, the panic is swallowed if nil
+	PanicFunc func(recovered interface{}, entryID int)
+	// ErrorFunc process the error of TryExecutor which rejects the jobs, the error is ignored if nil
+	ErrorFunc func(err error, entryID int)
+}
+
+// CronEntry is the snapshot of a job in Cron
+type CronEntry struct {
+	ID      int
+	Spec    string
+	Prev    time.Time
+	Next    time.Time
+	Running int
+	Pending int
+}
+
+type cronEntry struct {
+	id       int
+	spec     string
+	schedule Schedule
+	job      func()
+	overlap  OverlapPolicy
+	prev     time.Time
+	next     time.Time
+	running  int
+	pending  int
+}
+
+// Cron runs the jobs on their schedules
+type Cron struct {
+	option  CronOption
+	mu      sync.Mutex
+	entries map[int]*cronEntry
+	lastID  int
+	running bool
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+// NewCron create a instance of Cron with given option
+func NewCron(opt ...CronOption) *Cron {
+	option := CronOption{}
+	if len(opt) >= 1 {
+		option = opt[0]
+	}
+	if option.Location == nil {
+		option.Location = time.Local
+	}
+	if option.Executor == nil {
+		option.Executor = ExecutorFunc(func(f func()) { go f() })
+	}
+	if option.Clock == nil {
+		option.Clock = RealClock
+	}
+
+	return &Cron{
+		option:  option,
+		entries: make(map[int]*cronEntry),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// AddFunc add a job with cron expression, see ParseCron, return the id of entry
+func (c *Cron) AddFunc(spec string, f func(), overlap ...OverlapPolicy) (int, error) {
+	schedule, err := ParseCron(spec, c.option.Location)
+	if err != nil {
+		return 0, err
+	}
+	return c.add(spec, schedule, f, overlap...)
+}
+
+// Schedule add a job with the schedule, return the id of entry
+func (c *Cron) Schedule(schedule Schedule, f func(), overlap ...OverlapPolicy) (int, error) {
+	return c.add("", schedule, f, overlap...)
+}
+
+func (c *Cron) add(spec string, schedule Schedule, f func(), overlap ...OverlapPolicy) (int, error) {
+	if f == nil {
+		return 0, errors.New("cron job function is empty")
+	}
+
+	e := &cronEntry{
+		spec:     spec,
+		schedule: schedule,
+		job:      f,
+		overlap:  c.option.Overlap,
+		next:     schedule.Next(c.option.Clock.Now()),
+	}
+	if len(overlap) >= 1 {
+		e.overlap = overlap[0]
+	}
+
+	c.mu.Lock()
+	c.lastID++
+	e.id = c.lastID
+	c.entries[e.id] = e
+	c.mu.Unlock()
+
+	c.notify()
+	return e.id, nil
+}
+
+// Remove the job, the running one is not interrupted
+func (c *Cron) Remove(id int) {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+	c.notify()
+}
+
+// Entries return the snapshot of jobs order by id
+func (c *Cron) Entries() []CronEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CronEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, CronEntry{
+			ID:      e.id,
+			Spec:    e.spec,
+			Prev:    e.prev,
+			Next:    e.next,
+			Running: e.running,
+			Pending: e.pending,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// Start the scheduler in a goroutine, it is no-op if started
+func (c *Cron) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return
+	}
+	c.running = true
+	c.stop = make(chan struct{})
+	go c.run(c.stop)
+}
+
+// Stop the scheduler, the running jobs are not interrupted
+func (c *Cron) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running {
+		return
+	}
+	c.running = false
+	close(c.stop)
+}
+
+func (c *Cron) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Cron) run(stop chan struct{}) {
+	for {
+		var timer ClockTimer
+		var timeout <-chan time.Time
+		if next := c.nextTime(); !next.IsZero() {
+			timer = c.option.Clock.NewTimer(next.Sub(c.option.Clock.Now()))
+			timeout = timer.C()
+		}
+
+		select {
+		case <-timeout:
+			c.runDue(c.option.Clock.Now())
+		case <-c.wake:
+		case <-stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
+
+// nextTime return the earliest activation time of all jobs
+func (c *Cron) nextTime() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var next time.Time
+	for _, e := range c.entries {
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+	return next
+}
+
+// runDue dispatches the jobs activated before now
+func (c *Cron) runDue(now time.Time) {
+	c.mu.Lock()
+	var due []*cronEntry
+	for _, e := range c.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		// the next activation is computed from the scheduled time rather than now,
+		// so the schedule of fixed interval does not drift by the latency of dispatch,
+		// the activations missed are skipped
+		e.prev = e.next
+		if e.next = e.schedule.Next(e.prev); !e.next.IsZero() && !e.next.After(now) {
+			e.next = e.schedule.Next(now)
+		}
+
+		if e.running > 0 {
+			if e.overlap == OverlapSkip {
+				continue
+			}
+			if e.overlap == OverlapQueue {
+				e.pending++
+				continue
+			}
+		}
+		e.running++
+		due = append(due, e)
+	}
+	c.mu.Unlock()
+
+	for _, e := range due {
+		c.dispatch(e)
+	}
+}
+
+func (c *Cron) dispatch(e *cronEntry) {
+	job := func() {
+		c.runJob(e)
+
+		c.mu.Lock()
+		again := e.pending > 0
+		if again {
+			e.pending--
+		} else {
+			e.running--
+		}
+		c.mu.Unlock()
+
+		if again {
+			c.dispatch(e)
+		}
+	}
+
+	executor, ok := c.option.Executor.(TryExecutor)
+	if !ok {
+		c.option.Executor.Execute(job)
+		return
+	}
+	if err := executor.TryExecute(job); err != nil {
+		// the rejected run is finished, so the job is activated again by its schedule
+		c.mu.Lock()
+		e.running--
+		if e.running == 0 {
+			e.pending = 0
+		}
+		c.mu.Unlock()
+		if c.option.ErrorFunc != nil {
+			c.option.ErrorFunc(err, e.id)
+		}
+	}
+}
+
+func (c *Cron) runJob(e *cronEntry) {
+	defer func() {
+		if r := recover(); r != nil && c.option.PanicFunc != nil {
+			c.option.PanicFunc(r, e.id)
+		}
+	}()
+	e.job()
+}
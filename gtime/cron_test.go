@@ -0,0 +1,154 @@
+package gtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	from := time.Date(2019, 1, 31, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2019, 1, 31, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * * *", time.Date(2019, 1, 31, 10, 30, 30, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2019, 1, 31, 13, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * sun", time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2019, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * JAN,mar ?", time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2019, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2019, 1, 31, 10, 31, 45, 0, time.UTC)},
+		{"CRON_TZ=Asia/Shanghai 0 0 * * *", time.Date(2019, 2, 1, 0, 0, 0, 0, shanghai)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec, time.UTC)
+		if err != nil {
+			t.Fatalf("%s: parse error %v", tt.spec, err)
+		}
+		if next := s.Next(from); !next.Equal(tt.next) {
+			t.Fatalf("%s: next should be %v, but (%v)", tt.spec, tt.next, next)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@often", "@every -1s", "TZ=Mars/Base * * * * *"} {
+		if _, err := ParseCron(spec, nil); err == nil {
+			t.Fatalf("%s: should be invalid", spec)
+		}
+	}
+}
+
+func TestCronOverlap(t *testing.T) {
+	for _, tt := range []struct {
+		overlap OverlapPolicy
+		runs    int
+	}{{OverlapAllow, 3}, {OverlapSkip, 1}, {OverlapQueue, 3}} {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		runs := 0
+		release := make(chan struct{})
+
+		c := NewCron()
+		id, _ := c.AddFunc("* * * * * *", func() {
+			mu.Lock()
+			runs++
+			mu.Unlock()
+			<-release
+			wg.Done()
+		}, tt.overlap)
+		wg.Add(tt.runs)
+
+		now := c.Entries()[0].Next
+		for i := 0; i < 3; i++ {
+			c.runDue(now)
+			now = now.Add(time.Second)
+		}
+		close(release)
+		wg.Wait()
+
+		mu.Lock()
+		if runs != tt.runs {
+			t.Fatalf("Policy %d should run %d times, but (%d)", tt.overlap, tt.runs, runs)
+		}
+		mu.Unlock()
+		c.Remove(id)
+	}
+}
+
+func TestCronStart(t *testing.T) {
+	done := make(chan struct{}, 10)
+	c := NewCron(CronOption{PanicFunc: func(recovered interface{}, entryID int) {
+		done <- struct{}{}
+	}})
+	c.Start()
+	defer c.Stop()
+
+	if _, err := c.AddFunc("@every 10ms", func() { panic("job") }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cron job should run")
+	}
+	if entries := c.Entries(); len(entries) != 1 || entries[0].Prev.IsZero() {
+		t.Fatalf("Should record the prev time, but (%+v)", entries)
+	}
+}
+
+func TestCronDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		spec string
+		from time.Time
+		next []string
+	}{
+		// the clock goes back from 02:00 EDT to 01:00 EST
+		{"0 * * * *", time.Date(2019, 11, 3, 0, 30, 0, 0, ny),
+			[]string{"3 01:00 EDT", "3 02:00 EST", "3 03:00 EST"}},
+		{"30 1 * * *", time.Date(2019, 11, 3, 0, 30, 0, 0, ny),
+			[]string{"3 01:30 EDT", "4 01:30 EST"}},
+		// the clock jumps from 02:00 EST to 03:00 EDT
+		{"0 * * * *", time.Date(2019, 3, 10, 0, 30, 0, 0, ny),
+			[]string{"10 01:00 EST", "10 03:00 EDT", "10 04:00 EDT"}},
+		{"30 2 * * *", time.Date(2019, 3, 10, 0, 30, 0, 0, ny),
+			[]string{"10 03:30 EDT", "11 02:30 EDT"}},
+	}
+
+	for _, tt := range tests {
+		s, _ := ParseCron(tt.spec, ny)
+		next := tt.from
+		for _, want := range tt.next {
+			next = s.Next(next)
+			if got := next.Format("2 15:04 MST"); got != want {
+				t.Fatalf("%s: next should be %s, but (%s)", tt.spec, want, next)
+			}
+		}
+	}
+}
+
+func TestCronEvery(t *testing.T) {
+	c := NewCron()
+	c.AddFunc("@every 10s", func() {})
+
+	scheduled := c.Entries()[0].Next
+	c.runDue(scheduled.Add(time.Second))
+	if next := c.Entries()[0].Next; !next.Equal(scheduled.Add(10 * time.Second)) {
+		t.Fatalf("Should not drift by the latency, but (%v)", next.Sub(scheduled))
+	}
+
+	scheduled = c.Entries()[0].Next
+	c.runDue(scheduled.Add(25 * time.Second))
+	if next := c.Entries()[0].Next; !next.Equal(scheduled.Add(35 * time.Second)) {
+		t.Fatalf("Should skip the missed activations, but (%v)", next.Sub(scheduled))
+	}
+}
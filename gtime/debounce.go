@@ -0,0 +1,274 @@
+package gtime
+
+import (
+	"sync"
+	"time"
+)
+
+// Edge decides when the function is called in a burst of triggers
+type Edge int
+
+const (
+	// LeadingEdge calls the function at the first trigger of a burst
+	LeadingEdge Edge = 1 << iota
+	// TrailingEdge calls the function after the burst, if it is triggered after the leading call
+	TrailingEdge
+)
+
+var (
+	sharedWheel     *TimerWheel
+	sharedWheelOnce sync.Once
+)
+
+// SharedWheel returns the TimerWheel started on demand with 10ms tick,
+// it is used by Debouncer and Throttler if the wheel is not given
+func SharedWheel() *TimerWheel {
+	sharedWheelOnce.Do(func() {
+		sharedWheel = NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: defaultWheelCount})
+		sharedWheel.Start()
+	})
+	return sharedWheel
+}
+
+// DebounceOption is the configuration of Debouncer
+type DebounceOption struct {
+	Wait    time.Duration `json:"wait" yaml:"wait"`         // the quiet period to end a burst, default 100ms
+	Edge    Edge          `json:"edge" yaml:"edge"`         // default TrailingEdge
+	MaxWait time.Duration `json:"max_wait" yaml:"max_wait"` // the max duration of a burst, 0 is unlimited
+	Wheel   *TimerWheel   `json:"-" yaml:"-"`               // default SharedWheel
+}
+
+// Debouncer calls the function once for a burst of triggers, the burst ends when it is not
+// triggered in Wait, or it lasts MaxWait. The trailing call runs by the executor of wheel
+type Debouncer struct {
+	lock    sync.Mutex
+	f       func()
+	opt     DebounceOption
+	wheel   *TimerWheel
+	timer   *Timer
+	gen     uint64        // 定时器的代数，忽略已被替换的定时器
+	first   time.Duration // 本轮第一次触发时时钟轮的时间
+	pending bool          // 有待执行的 trailing 调用
+}
+
+// NewDebouncer creates a debouncer of f with given options
+func NewDebouncer(f func(), opt ...DebounceOption) *Debouncer {
+	d := &Debouncer{f: f, opt: DebounceOption{Wait: 100 * time.Millisecond, Edge: TrailingEdge}}
+	if len(opt) >= 1 {
+		if opt[0].Wait > 0 {
+			d.opt.Wait = opt[0].Wait
+		}
+		if opt[0].Edge != 0 {
+			d.opt.Edge = opt[0].Edge
+		}
+		d.opt.MaxWait = opt[0].MaxWait
+		d.opt.Wheel = opt[0].Wheel
+	}
+
+	d.wheel = d.opt.Wheel
+	if d.wheel == nil {
+		d.wheel = SharedWheel()
+	}
+	return d
+}
+
+// Trigger starts or extends the burst, the leading call runs in the calling goroutine
+func (d *Debouncer) Trigger() {
+	d.lock.Lock()
+	now := d.wheel.elapsed()
+	wait := d.opt.Wait
+	leading := false
+	if d.timer == nil {
+		d.first = now
+		leading = d.opt.Edge&LeadingEdge != 0
+		d.pending = !leading
+	} else {
+		d.timer.Stop()
+		d.pending = true
+		if d.opt.MaxWait > 0 {
+			if left := d.first + d.opt.MaxWait - now; left < wait {
+				wait = left
+			}
+		}
+	}
+	d.schedule(wait)
+	d.lock.Unlock()
+
+	if leading {
+		d.f()
+	}
+}
+
+// Flush ends the burst and runs the pending trailing call in the calling goroutine
+func (d *Debouncer) Flush() {
+	if d.stop() && d.opt.Edge&TrailingEdge != 0 {
+		d.f()
+	}
+}
+
+// Cancel ends the burst and drops the pending trailing call
+func (d *Debouncer) Cancel() {
+	d.stop()
+}
+
+// Pending reports whether there is a trailing call waiting
+func (d *Debouncer) Pending() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.pending && d.opt.Edge&TrailingEdge != 0
+}
+
+// stop the timer and returns whether a call is pending
+func (d *Debouncer) stop() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+	pending := d.pending
+	d.pending = false
+	return pending
+}
+
+// schedule the end of burst, must hold lock
+func (d *Debouncer) schedule(wait time.Duration) {
+	if wait <= 0 {
+		wait = time.Nanosecond
+	}
+	d.gen++
+	gen := d.gen
+	d.timer, _ = d.wheel.AfterFunc(wait, 1, func() { d.expire(gen) })
+}
+
+func (d *Debouncer) expire(gen uint64) {
+	d.lock.Lock()
+	if gen != d.gen {
+		d.lock.Unlock()
+		return
+	}
+	d.timer = nil
+	pending := d.pending
+	d.pending = false
+	d.lock.Unlock()
+
+	if pending && d.opt.Edge&TrailingEdge != 0 {
+		d.f()
+	}
+}
+
+// ThrottleOption is the configuration of Throttler
+type ThrottleOption struct {
+	Interval time.Duration `json:"interval" yaml:"interval"` // the min interval between calls, default 100ms
+	Edge     Edge          `json:"edge" yaml:"edge"`         // default LeadingEdge | TrailingEdge
+	Wheel    *TimerWheel   `json:"-" yaml:"-"`               // default SharedWheel
+}
+
+// Throttler calls the function at most once in every Interval, the triggers in the interval
+// are coalesced into one trailing call at the end of it. The trailing call runs by the executor of wheel
+type Throttler struct {
+	lock    sync.Mutex
+	f       func()
+	opt     ThrottleOption
+	wheel   *TimerWheel
+	timer   *Timer
+	gen     uint64 // 定时器的代数，忽略已被替换的定时器
+	pending bool   // 有待执行的 trailing 调用
+}
+
+// NewThrottler creates a throttler of f with given options
+func NewThrottler(f func(), opt ...ThrottleOption) *Throttler {
+	t := &Throttler{f: f, opt: ThrottleOption{Interval: 100 * time.Millisecond, Edge: LeadingEdge | TrailingEdge}}
+	if len(opt) >= 1 {
+		if opt[0].Interval > 0 {
+			t.opt.Interval = opt[0].Interval
+		}
+		if opt[0].Edge != 0 {
+			t.opt.Edge = opt[0].Edge
+		}
+		t.opt.Wheel = opt[0].Wheel
+	}
+
+	t.wheel = t.opt.Wheel
+	if t.wheel == nil {
+		t.wheel = SharedWheel()
+	}
+	return t
+}
+
+// Trigger calls the function at once if it is not called in the interval, otherwise it is deferred
+// to the end of interval. It returns whether the function is called in the calling goroutine
+func (t *Throttler) Trigger() bool {
+	t.lock.Lock()
+	leading := false
+	if t.timer == nil {
+		leading = t.opt.Edge&LeadingEdge != 0
+		t.pending = !leading
+		t.schedule()
+	} else {
+		t.pending = true
+	}
+	t.lock.Unlock()
+
+	if leading {
+		t.f()
+	}
+	return leading
+}
+
+// Flush runs the pending trailing call in the calling goroutine, a new interval is started by it
+func (t *Throttler) Flush() {
+	t.lock.Lock()
+	if !t.pending || t.opt.Edge&TrailingEdge == 0 {
+		t.lock.Unlock()
+		return
+	}
+	t.pending = false
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.schedule()
+	t.lock.Unlock()
+
+	t.f()
+}
+
+// Cancel drops the pending trailing call and resets the interval
+func (t *Throttler) Cancel() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.gen++
+	t.pending = false
+}
+
+// schedule the end of interval, must hold lock
+func (t *Throttler) schedule() {
+	t.gen++
+	gen := t.gen
+	t.timer, _ = t.wheel.AfterFunc(t.opt.Interval, 1, func() { t.expire(gen) })
+}
+
+func (t *Throttler) expire(gen uint64) {
+	t.lock.Lock()
+	if gen != t.gen {
+		t.lock.Unlock()
+		return
+	}
+	if !t.pending || t.opt.Edge&TrailingEdge == 0 {
+		t.timer = nil
+		t.pending = false
+		t.lock.Unlock()
+		return
+	}
+	// trailing 调用开始新的周期
+	t.pending = false
+	t.schedule()
+	t.lock.Unlock()
+
+	t.f()
+}
@@ -0,0 +1,103 @@
+package gtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Executor: InlineExecutor})
+	calls := 0
+	d := NewDebouncer(func() { calls++ }, DebounceOption{Wait: 50 * time.Millisecond, Wheel: wheel})
+
+	for i := 0; i < 5; i++ {
+		d.Trigger()
+		wheel.Advance(30 * time.Millisecond)
+	}
+	if calls != 0 || !d.Pending() {
+		t.Fatalf("Should wait for the quiet period, but (%d)", calls)
+	}
+	wheel.Advance(30 * time.Millisecond)
+	if calls != 1 || d.Pending() {
+		t.Fatalf("Should call once after the burst, but (%d)", calls)
+	}
+
+	d.Trigger()
+	d.Cancel()
+	wheel.Advance(100 * time.Millisecond)
+	if calls != 1 {
+		t.Fatalf("Should drop the canceled call, but (%d)", calls)
+	}
+	d.Trigger()
+	d.Flush()
+	if calls != 2 {
+		t.Fatalf("Should run the flushed call, but (%d)", calls)
+	}
+}
+
+func TestDebouncerEdgeMaxWait(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Executor: InlineExecutor})
+	calls := 0
+	d := NewDebouncer(func() { calls++ }, DebounceOption{Wait: 50 * time.Millisecond,
+		Edge: LeadingEdge | TrailingEdge, MaxWait: 100 * time.Millisecond, Wheel: wheel})
+
+	d.Trigger()
+	if calls != 1 {
+		t.Fatalf("Should call at the leading edge, but (%d)", calls)
+	}
+	wheel.Advance(100 * time.Millisecond)
+	if calls != 1 {
+		t.Fatalf("Should not call at the trailing edge without triggers, but (%d)", calls)
+	}
+
+	// the burst is cut by MaxWait: leading at 0, trailing at 100ms, leading of the next burst at 120ms
+	for i := 0; i < 7; i++ {
+		d.Trigger()
+		wheel.Advance(20 * time.Millisecond)
+	}
+	if calls != 4 {
+		t.Fatalf("Should call 3 times in the long burst, but (%d)", calls)
+	}
+}
+
+func TestThrottler(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Executor: InlineExecutor})
+	calls := 0
+	th := NewThrottler(func() { calls++ }, ThrottleOption{Interval: 50 * time.Millisecond, Wheel: wheel})
+
+	if !th.Trigger() || th.Trigger() {
+		t.Fatal("Should call only the first trigger at once")
+	}
+	for i := 0; i < 10; i++ {
+		th.Trigger()
+		wheel.Advance(10 * time.Millisecond)
+	}
+	// leading at 0, trailing at 50ms and 100ms
+	if calls != 3 {
+		t.Fatalf("Should call once per interval, but (%d)", calls)
+	}
+	wheel.Advance(100 * time.Millisecond)
+	if calls != 3 || !th.Trigger() {
+		t.Fatalf("Should call at once after idle, but (%d)", calls)
+	}
+
+	th = NewThrottler(func() { calls++ }, ThrottleOption{Interval: 50 * time.Millisecond, Edge: LeadingEdge, Wheel: wheel})
+	calls = 0
+	th.Trigger()
+	th.Trigger()
+	wheel.Advance(100 * time.Millisecond)
+	if calls != 1 {
+		t.Fatalf("Should drop the trailing call, but (%d)", calls)
+	}
+}
+
+func TestSharedWheel(t *testing.T) {
+	done := make(chan struct{})
+	d := NewDebouncer(func() { close(done) }, DebounceOption{Wait: 20 * time.Millisecond})
+	d.Trigger()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Should call by the shared wheel")
+	}
+}
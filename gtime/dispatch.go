@@ -0,0 +1,96 @@
+package gtime
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InlineExecutor runs the function in the calling goroutine, the callbacks of TimerWheel
+// must be short with it, otherwise the following timers are fired late
+var InlineExecutor Executor = ExecutorFunc(func(f func()) { f() })
+
+// goExecutor runs every function in a new goroutine
+var goExecutor Executor = ExecutorFunc(func(f func()) { go f() })
+
+// BoundedExecutor runs the functions by a fixed number of goroutines,
+// Execute blocks if all of them are busy and the queue is full
+type BoundedExecutor struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewBoundedExecutor creates a executor with workers goroutines and a queue of queueSize
+func NewBoundedExecutor(workers, queueSize int) *BoundedExecutor {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	e := &BoundedExecutor{jobs: make(chan func(), queueSize)}
+	e.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer e.wg.Done()
+			for f := range e.jobs {
+				f()
+			}
+		}()
+	}
+	return e
+}
+
+// Execute implements Executor, it must not be called after Close
+func (e *BoundedExecutor) Execute(f func()) {
+	e.jobs <- f
+}
+
+// Close waits for the queued functions to finish and stops the goroutines
+func (e *BoundedExecutor) Close() {
+	e.once.Do(func() {
+		close(e.jobs)
+	})
+	e.wg.Wait()
+}
+
+// ChanPolicy decides how to deliver the event of the timer of After, the event is never blocked
+type ChanPolicy int
+
+const (
+	// ChanCoalesce buffers one event, the events fired before it is received are coalesced into it
+	ChanCoalesce ChanPolicy = iota
+	// ChanDrop delivers the event only if the receiver is waiting, otherwise it is dropped
+	ChanDrop
+)
+
+// TwStats is the statistics of TimerWheel
+type TwStats struct {
+	Timers      int           // active timers
+	Fired       int64         // fired times of all timers
+	Late        int64         // fired later than one tick after the deadline, only measured after Start
+	MaxLateness time.Duration // max delay between the deadline and the callback started
+	Dropped     int64         // events of After dropped or coalesced
+	Panics      int64         // panics recovered from callbacks
+}
+
+type twStats struct {
+	fired       int64
+	late        int64
+	maxLateness int64
+	dropped     int64
+	panics      int64
+}
+
+func (s *twStats) recordLateness(lateness, tick time.Duration) {
+	if lateness > tick {
+		atomic.AddInt64(&s.late, 1)
+	}
+	for max := atomic.LoadInt64(&s.maxLateness); int64(lateness) > max; max = atomic.LoadInt64(&s.maxLateness) {
+		if atomic.CompareAndSwapInt64(&s.maxLateness, max, int64(lateness)) {
+			break
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package gtime
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimerWheelExecutor(t *testing.T) {
+	executor := NewBoundedExecutor(2, 4)
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Executor: executor})
+	wheel.Start()
+
+	var fired int32
+	wheel.AfterFunc(10*time.Millisecond, 3, func() { atomic.AddInt32(&fired, 1) })
+	time.Sleep(100 * time.Millisecond)
+	wheel.Stop()
+	executor.Close()
+	if n := atomic.LoadInt32(&fired); n != 3 {
+		t.Fatalf("Should fire 3 times by executor, but (%d)", n)
+	}
+	if stats := wheel.Stats(); stats.Fired != 3 || stats.Timers != 0 {
+		t.Fatalf("Should count 3 firings, but (%+v)", stats)
+	}
+}
+
+func TestTimerWheelPanic(t *testing.T) {
+	var recovered interface{}
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8,
+		PanicFunc: func(r interface{}) { recovered = r }})
+
+	fired := 0
+	wheel.AfterFunc(10*time.Millisecond, 1, func() { panic("boom") })
+	wheel.AfterFunc(20*time.Millisecond, 1, func() { fired++ })
+	wheel.Advance(20 * time.Millisecond)
+	if recovered != "boom" || fired != 1 {
+		t.Fatalf("Should recover the panic and go on, but (%v, %d)", recovered, fired)
+	}
+	if stats := wheel.Stats(); stats.Panics != 1 {
+		t.Fatalf("Should count the panic, but (%+v)", stats)
+	}
+}
+
+func TestTimerWheelChanPolicy(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8})
+	ch, _, _ := wheel.After(10*time.Millisecond, 3)
+	wheel.Advance(30 * time.Millisecond)
+	if _, ok := <-ch; !ok {
+		t.Fatal("Should coalesce the events into one")
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("Should close the channel after the last firing")
+	}
+	if stats := wheel.Stats(); stats.Dropped != 2 {
+		t.Fatalf("Should coalesce 2 events, but (%+v)", stats)
+	}
+
+	wheel = NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, ChanPolicy: ChanDrop})
+	ch, _, _ = wheel.After(10*time.Millisecond, 3)
+	wheel.Advance(30 * time.Millisecond)
+	if _, ok := <-ch; ok {
+		t.Fatal("Should drop the events without receiver")
+	}
+	if stats := wheel.Stats(); stats.Dropped != 3 {
+		t.Fatalf("Should drop 3 events, but (%+v)", stats)
+	}
+}
+
+func TestTimerWheelLateness(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8,
+		Clock: clock, Executor: InlineExecutor})
+	wheel.Start()
+	defer wheel.Stop()
+
+	fired := make(chan struct{}, 10)
+	wheel.AfterFunc(10*time.Millisecond, 1, func() { fired <- struct{}{} })
+	wheel.AfterFunc(100*time.Millisecond, 1, func() { fired <- struct{}{} })
+	clock.BlockUntil(1)
+	// the ticks dropped by the ticker are caught up
+	clock.Advance(100 * time.Millisecond)
+	<-fired
+	<-fired
+
+	stats := wheel.Stats()
+	if stats.Fired != 2 || stats.Late != 1 || stats.MaxLateness != 90*time.Millisecond {
+		t.Fatalf("Should measure the lateness of the first timer, but (%+v)", stats)
+	}
+}
@@ -0,0 +1,389 @@
+package gtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultCompactThreshold = 1024
+
+// DurableTimer is a timer persisted by DurableStore, the payload is opaque to the store
+type DurableTimer struct {
+	ID       string    `json:"id"`
+	Deadline time.Time `json:"deadline"`
+	Payload  []byte    `json:"payload,omitempty"`
+}
+
+// DurableOption is the configuration of DurableStore
+type DurableOption struct {
+	Path string `json:"path" yaml:"path"` // the file of log, required
+	// Sync flushes every record to disk before Add and Remove return, otherwise the records
+	// may be lost with the os crash, but not with the process crash
+	Sync bool `json:"sync" yaml:"sync"`
+	// CompactThreshold is the number of dead records to rewrite the log, default 1024
+	CompactThreshold int `json:"compact_threshold" yaml:"compact_threshold"`
+	// ErrorFunc receives the errors of the background writes, which are the compaction of log and
+	// the removal of fired timers, the errors are ignored if nil
+	ErrorFunc func(err error) `json:"-" yaml:"-"`
+}
+
+// DurableStore keeps the timers with absolute deadlines in a append-only log, and schedules them
+// on a TimerWheel. The timers are reloaded when the store is opened after restart, the overdue
+// ones are fired one by one in deadline order by a single task of the executor of wheel.
+// A timer is removed from the log after its handler returns, so it is fired at least once,
+// the handler should be idempotent.
+type DurableStore struct {
+	lock    sync.Mutex
+	wheel   *TimerWheel
+	handler func(DurableTimer)
+	opt     DurableOption
+	file    *os.File
+	timers  map[string]*durableEntry
+	dead    int // 日志中已失效的记录数
+	closed  bool
+}
+
+type durableEntry struct {
+	timer  DurableTimer
+	handle *Timer
+}
+
+// durableRecord is a line of log
+type durableRecord struct {
+	Op string `json:"op"` // add or del
+	DurableTimer
+}
+
+// OpenDurableStore loads the timers from the log and schedules them on the wheel,
+// handler is called by the executor of wheel when a timer expires
+func OpenDurableStore(wheel *TimerWheel, handler func(DurableTimer), opt DurableOption) (*DurableStore, error) {
+	if wheel == nil || handler == nil {
+		return nil, errors.New("wheel and handler must not be nil")
+	}
+	if opt.Path == "" {
+		return nil, errors.New("path of durable store is empty")
+	}
+	if opt.CompactThreshold <= 0 {
+		opt.CompactThreshold = defaultCompactThreshold
+	}
+
+	s := &DurableStore{
+		wheel:   wheel,
+		handler: handler,
+		opt:     opt,
+		timers:  make(map[string]*durableEntry),
+	}
+
+	timers, err := loadDurableLog(opt.Path)
+	if err != nil {
+		return nil, err
+	}
+	for _, timer := range timers {
+		s.timers[timer.ID] = &durableEntry{timer: timer}
+	}
+
+	// 重写日志，去掉失效的记录
+	s.lock.Lock()
+	if err := s.rewrite(); err != nil {
+		if s.file != nil {
+			s.file.Close()
+		}
+		s.lock.Unlock()
+		return nil, err
+	}
+
+	sort.Slice(timers, func(i, j int) bool { return timers[i].Deadline.Before(timers[j].Deadline) })
+	now := wheel.clock.Now()
+	overdue := []*durableEntry{}
+	for _, timer := range timers {
+		entry := s.timers[timer.ID]
+		if timer.Deadline.After(now) {
+			s.schedule(entry)
+		} else {
+			overdue = append(overdue, entry)
+		}
+	}
+	s.lock.Unlock()
+
+	// 已过期的定时器在同一个任务中按到期时间顺序依次触发
+	if len(overdue) > 0 {
+		wheel.executor.Execute(func() {
+			for _, entry := range overdue {
+				s.fire(entry)
+			}
+		})
+	}
+	return s, nil
+}
+
+// loadDurableLog replays the log, a torn record at the end written by a crash is ignored
+func loadDurableLog(path string) ([]DurableTimer, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	timers := make(map[string]DurableTimer)
+	order := []string{}
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var rec durableRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("invalid record at line %d of %s: %v", line, path, err)
+		}
+		switch rec.Op {
+		case "add":
+			if _, ok := timers[rec.ID]; !ok {
+				order = append(order, rec.ID)
+			}
+			timers[rec.ID] = rec.DurableTimer
+		case "del":
+			delete(timers, rec.ID)
+		default:
+			return nil, fmt.Errorf("unknown op %q at line %d of %s", rec.Op, line, path)
+		}
+	}
+
+	result := make([]DurableTimer, 0, len(timers))
+	for _, id := range order {
+		if timer, ok := timers[id]; ok {
+			result = append(result, timer)
+			delete(timers, id)
+		}
+	}
+	return result, nil
+}
+
+// Add persists the timer and schedules it, the timer with the same id is replaced.
+// The timer is fired on the next tick of wheel if the deadline is passed
+func (s *DurableStore) Add(id string, deadline time.Time, payload []byte) error {
+	if id == "" {
+		return errors.New("id of timer is empty")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errors.New("durable store is closed")
+	}
+
+	timer := DurableTimer{ID: id, Deadline: deadline, Payload: payload}
+	if err := s.append(durableRecord{Op: "add", DurableTimer: timer}); err != nil {
+		return err
+	}
+	if old, ok := s.timers[id]; ok {
+		old.stop()
+		s.dead++
+	}
+
+	entry := &durableEntry{timer: timer}
+	s.timers[id] = entry
+	s.schedule(entry)
+	s.maybeCompact()
+	return nil
+}
+
+// Remove cancels the timer and removes it from the log, returns false if it does not exist
+func (s *DurableStore) Remove(id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return false, errors.New("durable store is closed")
+	}
+
+	entry, ok := s.timers[id]
+	if !ok {
+		return false, nil
+	}
+	if err := s.append(durableRecord{Op: "del", DurableTimer: DurableTimer{ID: id}}); err != nil {
+		return false, err
+	}
+	entry.stop()
+	delete(s.timers, id)
+	s.dead += 2
+	s.maybeCompact()
+	return true, nil
+}
+
+// Pending returns the timers not fired yet, sorted by deadline
+func (s *DurableStore) Pending() []DurableTimer {
+	s.lock.Lock()
+	timers := make([]DurableTimer, 0, len(s.timers))
+	for _, entry := range s.timers {
+		timers = append(timers, entry.timer)
+	}
+	s.lock.Unlock()
+
+	sort.Slice(timers, func(i, j int) bool { return timers[i].Deadline.Before(timers[j].Deadline) })
+	return timers
+}
+
+// Compact rewrites the log with the pending timers only
+func (s *DurableStore) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errors.New("durable store is closed")
+	}
+	return s.rewrite()
+}
+
+// Close stops the timers and closes the log, the timers are kept in the log for next open
+func (s *DurableStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+	for _, entry := range s.timers {
+		entry.stop()
+	}
+	return s.file.Close()
+}
+
+// schedule the timer on wheel, must hold lock
+func (s *DurableStore) schedule(entry *durableEntry) {
+	delay := entry.timer.Deadline.Sub(s.wheel.clock.Now())
+	if delay <= 0 {
+		delay = s.wheel.tickDuration
+	}
+	entry.handle, _ = s.wheel.AfterFunc(delay, 1, func() { s.fire(entry) })
+}
+
+// fire calls the handler and removes the timer from log after it returns
+func (s *DurableStore) fire(entry *durableEntry) {
+	s.lock.Lock()
+	if s.closed || s.timers[entry.timer.ID] != entry {
+		s.lock.Unlock()
+		return
+	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.closed || s.timers[entry.timer.ID] != entry {
+			return
+		}
+		delete(s.timers, entry.timer.ID)
+		// 写失败时定时器在重启后会再次触发
+		if err := s.append(durableRecord{Op: "del", DurableTimer: DurableTimer{ID: entry.timer.ID}}); err != nil {
+			s.reportError(err)
+			return
+		}
+		s.dead += 2
+		s.maybeCompact()
+	}()
+	s.wheel.runTask(func() { s.handler(entry.timer) })
+}
+
+// append a record to log, must hold lock
+func (s *DurableStore) append(rec durableRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if s.opt.Sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// maybeCompact rewrites the log if there are too many dead records, must hold lock
+func (s *DurableStore) maybeCompact() {
+	if s.dead >= s.opt.CompactThreshold && s.dead > len(s.timers) {
+		if err := s.rewrite(); err != nil {
+			s.reportError(fmt.Errorf("compact %s: %v", s.opt.Path, err))
+		}
+	}
+}
+
+func (s *DurableStore) reportError(err error) {
+	if s.opt.ErrorFunc != nil {
+		s.opt.ErrorFunc(err)
+	}
+}
+
+// rewrite the log by a temporary file and rename, the temporary file is opened for appending
+// and becomes the log after rename, so the log is never reopened, must hold lock
+func (s *DurableStore) rewrite() error {
+	tmp := s.opt.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range s.timers {
+		if err = enc.Encode(durableRecord{Op: "add", DurableTimer: entry.timer}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.opt.Path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.dead = 0
+	// 同步目录，保证重命名在崩溃后仍然有效
+	return syncDir(filepath.Dir(s.opt.Path))
+}
+
+// syncDir flushes the entries of directory to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (e *durableEntry) stop() {
+	if e.handle != nil {
+		e.handle.Stop()
+	}
+}
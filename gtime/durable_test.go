@@ -0,0 +1,113 @@
+package gtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurableStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "timers.log")
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fired := []string{}
+	open := func() (*DurableStore, *TimerWheel) {
+		wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8,
+			Clock: clock, Executor: InlineExecutor})
+		store, err := OpenDurableStore(wheel, func(timer DurableTimer) {
+			fired = append(fired, timer.ID+":"+string(timer.Payload))
+		}, DurableOption{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, wheel
+	}
+
+	store, wheel := open()
+	store.Add("a", start.Add(50*time.Millisecond), []byte("order-1"))
+	store.Add("b", start.Add(200*time.Millisecond), []byte("order-2"))
+	store.Add("c", start.Add(300*time.Millisecond), nil)
+	if ok, err := store.Remove("c"); !ok || err != nil {
+		t.Fatalf("Should remove c, but (%v, %v)", ok, err)
+	}
+	wheel.Advance(100 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != "a:order-1" {
+		t.Fatalf("Should fire a, but (%v)", fired)
+	}
+	store.Close()
+
+	// restart after the deadline of b
+	clock.Advance(500 * time.Millisecond)
+	store, _ = open()
+	if len(fired) != 2 || fired[1] != "b:order-2" {
+		t.Fatalf("Should fire the overdue b on open, but (%v)", fired)
+	}
+	store.Add("d", start.Add(time.Second), []byte("order-4"))
+	store.Close()
+
+	// a torn record at the end is ignored
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"op":"add","id":"x"`)
+	f.Close()
+
+	store, _ = open()
+	defer store.Close()
+	if pending := store.Pending(); len(pending) != 1 || pending[0].ID != "d" || !pending[0].Deadline.Equal(start.Add(time.Second)) {
+		t.Fatalf("Should reload d, but (%v)", pending)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Fatalf("Should compact the log on open, but (%d) lines", lines)
+	}
+}
+
+func TestDurableStoreCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "timers.log")
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	wheel := NewTimerWheel(TwOption{TickDuration: 10 * time.Millisecond, WheelCount: 8, Clock: clock})
+	errs := []error{}
+	opt := DurableOption{Path: path, CompactThreshold: 2, ErrorFunc: func(err error) { errs = append(errs, err) }}
+	store, err := OpenDurableStore(wheel, func(DurableTimer) {}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add("a", start.Add(time.Second), nil)
+	store.Add("b", start.Add(time.Second), nil)
+	store.Remove("a")
+	// written to the log after compaction
+	store.Add("c", start.Add(500*time.Millisecond), nil)
+	store.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 2 || len(errs) != 0 {
+		t.Fatalf("Should compact the log, but (%d) lines and (%v)", lines, errs)
+	}
+
+	// the overdue timers are fired one by one in deadline order
+	clock.Advance(time.Hour)
+	fired := make(chan string, 2)
+	store, err = OpenDurableStore(wheel, func(timer DurableTimer) { fired <- timer.ID }, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if first, second := <-fired, <-fired; first != "c" || second != "b" {
+		t.Fatalf("Should fire in deadline order, but (%s, %s)", first, second)
+	}
+}
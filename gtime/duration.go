@@ -0,0 +1,143 @@
+package gtime
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Day is the duration of 24 hours, it ignores the daylight saving time
+	Day = 24 * time.Hour
+	// Week is the duration of 7 days
+	Week = 7 * Day
+)
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "nanosecond": time.Nanosecond, "nanoseconds": time.Nanosecond,
+	"us": time.Microsecond, "µs": time.Microsecond, "microsecond": time.Microsecond, "microseconds": time.Microsecond,
+	"ms": time.Millisecond, "millisecond": time.Millisecond, "milliseconds": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": Day, "day": Day, "days": Day,
+	"w": Week, "wk": Week, "wks": Week, "week": Week, "weeks": Week,
+}
+
+// formatUnits are the units used by FormatDuration, from the largest
+var formatUnits = []struct {
+	unit string
+	d    time.Duration
+}{
+	{"w", Week}, {"d", Day}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second},
+	{"ms", time.Millisecond}, {"us", time.Microsecond}, {"ns", time.Nanosecond},
+}
+
+// ParseDuration parses the human duration such as "1d2h", "3 weeks", "1 day, 2.5 hours" or "-90s".
+// The units of time.ParseDuration are supported, and d (day) and w (week) which are fixed to 24 hours
+// and 7 days. The terms could be separated by spaces and commas
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = strings.TrimSpace(s[1:])
+	}
+	if s == "" {
+		return 0, errors.New("invalid duration " + strconv.Quote(orig))
+	}
+	if s == "0" {
+		return 0, nil
+	}
+
+	var total int64
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		intPart, frac := s[:i], ""
+		if i < len(s) && s[i] == '.' {
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			frac, i = s[i+1:j], j
+		}
+		if intPart == "" && frac == "" {
+			return 0, errors.New("invalid duration " + strconv.Quote(orig))
+		}
+
+		s = strings.TrimLeft(s[i:], " ")
+		j := 0
+		for j < len(s) && !(s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == ' ' || s[j] == ',') {
+			j++
+		}
+		unit, ok := durationUnits[strings.ToLower(s[:j])]
+		if !ok {
+			return 0, errors.New("unknown unit " + strconv.Quote(s[:j]) + " in duration " + strconv.Quote(orig))
+		}
+		v, ok := durationTerm(intPart, frac, unit)
+		if !ok || total > math.MaxInt64-v {
+			return 0, errors.New("invalid duration " + strconv.Quote(orig))
+		}
+		total += v
+		s = strings.TrimLeft(s[j:], " ,")
+	}
+
+	if neg {
+		return -time.Duration(total), nil
+	}
+	return time.Duration(total), nil
+}
+
+// durationTerm returns the nanoseconds of a term, the integer part is exact and only
+// the fractional part is computed in float, returns false if it overflows
+func durationTerm(intPart, frac string, unit time.Duration) (int64, bool) {
+	var v int64
+	if intPart != "" {
+		n, err := strconv.ParseInt(intPart, 10, 64)
+		if err != nil || n > math.MaxInt64/int64(unit) {
+			return 0, false
+		}
+		v = n * int64(unit)
+	}
+	if frac != "" {
+		f, err := strconv.ParseFloat("0."+frac, 64)
+		if err != nil {
+			return 0, false
+		}
+		fv := int64(f * float64(unit))
+		if v > math.MaxInt64-fv {
+			return 0, false
+		}
+		v += fv
+	}
+	return v, true
+}
+
+// FormatDuration formats the duration by the units from week to nanosecond, e.g. "1w2d3h4m5s",
+// the result could be parsed by ParseDuration
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	var b strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	for _, f := range formatUnits {
+		if n := u / uint64(f.d); n > 0 {
+			b.WriteString(strconv.FormatUint(n, 10))
+			b.WriteString(f.unit)
+			u -= n * uint64(f.d)
+		}
+	}
+	return b.String()
+}
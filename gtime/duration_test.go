@@ -0,0 +1,45 @@
+package gtime
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		in  string
+		out time.Duration
+	}{
+		{"1d2h", Day + 2*time.Hour},
+		{"3 weeks", 3 * Week},
+		{"1 day, 2.5 hours", Day + 150*time.Minute},
+		{"-90s", -90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"250ms", 250 * time.Millisecond},
+		{"0", 0},
+		{".5s", 500 * time.Millisecond},
+		{"28w4d1ns", 28*Week + 4*Day + 1},
+		{"9223372036854775807ns", math.MaxInt64},
+	}
+	for _, c := range cases {
+		if d, err := ParseDuration(c.in); err != nil || d != c.out {
+			t.Errorf("ParseDuration(%q) should be (%v), but (%v, %v)", c.in, c.out, d, err)
+		}
+	}
+
+	for _, in := range []string{"", "d", "3 fortnights", "1..5h", "-", ".", "9223372036854775808ns", "106752d"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q) should fail", in)
+		}
+	}
+
+	for _, d := range []time.Duration{28*Week + 4*Day + 1, math.MaxInt64, Week + 2*Day + 3*time.Hour + 4*time.Minute + 5*time.Second, -1500 * time.Millisecond, 0} {
+		if back, err := ParseDuration(FormatDuration(d)); err != nil || back != d {
+			t.Errorf("FormatDuration(%v) = %q should be parsed back, but (%v, %v)", d, FormatDuration(d), back, err)
+		}
+	}
+	if s := FormatDuration(Day + 2*time.Hour); s != "1d2h" {
+		t.Errorf("Should format as 1d2h, but (%s)", s)
+	}
+}
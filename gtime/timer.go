@@ -0,0 +1,71 @@
+package gtime
+
+import (
+	"strconv"
+	"time"
+)
+
+// Timer is the handle of a timer in TimerWheel
+type Timer struct {
+	wheel   *TimerWheel
+	timeOut *wheelTimeOut
+}
+
+// ID returns the id of timer, which could be used by TimerWheel.Cancel
+func (t *Timer) ID() string {
+	return strconv.FormatUint(t.timeOut.id, 10)
+}
+
+// Stop prevents the timer from firing, returns false if the timer has been stopped or expired
+func (t *Timer) Stop() bool {
+	t.wheel.lock.Lock()
+	defer t.wheel.lock.Unlock()
+
+	if !t.active() {
+		return false
+	}
+	t.wheel.removeTimeOut(t.timeOut)
+	return true
+}
+
+// Reset restarts the timer with the new interval and trigger times counted from zero,
+// returns true if the timer had been active.
+// The timer of After can not be reset after its channel is closed, it returns false
+func (t *Timer) Reset(interval time.Duration) bool {
+	if interval <= 0 {
+		return false
+	}
+
+	t.wheel.lock.Lock()
+	defer t.wheel.lock.Unlock()
+
+	active := t.active()
+	if !active && t.timeOut.outCh != nil && t.timeOut.expTimes >= t.timeOut.times {
+		return false
+	}
+	if active {
+		t.wheel.removeTimeOut(t.timeOut)
+	}
+	t.timeOut.delay = interval
+	t.timeOut.expTimes = 0
+	t.wheel.scheduleTimeOut(t.timeOut)
+	return active
+}
+
+// Remaining returns the duration until the timer fires next time, 0 if it is not active,
+// it is rounded to the tick duration of wheel
+func (t *Timer) Remaining() time.Duration {
+	t.wheel.lock.Lock()
+	defer t.wheel.lock.Unlock()
+
+	if !t.active() {
+		return 0
+	}
+	return time.Duration(t.timeOut.expiration-t.wheel.currentTick) * t.wheel.tickDuration
+}
+
+// active reports whether the timer is scheduled, must hold lock
+func (t *Timer) active() bool {
+	timeOut, ok := t.wheel.timers[t.timeOut.id]
+	return ok && timeOut == t.timeOut
+}
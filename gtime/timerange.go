@@ -0,0 +1,102 @@
+package gtime
+
+import (
+	"sort"
+	"time"
+)
+
+// TimeRange is the half-open interval [Start, End)
+type TimeRange struct {
+	Start time.Time `json:"start" yaml:"start"`
+	End   time.Time `json:"end" yaml:"end"`
+}
+
+// NewTimeRange creates a range from start, the duration could be negative
+func NewTimeRange(start time.Time, d time.Duration) TimeRange {
+	if d < 0 {
+		return TimeRange{Start: start.Add(d), End: start}
+	}
+	return TimeRange{Start: start, End: start.Add(d)}
+}
+
+// Duration returns the length of range, 0 if it is empty
+func (r TimeRange) Duration() time.Duration {
+	if r.Empty() {
+		return 0
+	}
+	return r.End.Sub(r.Start)
+}
+
+// Empty reports whether the range contains no time
+func (r TimeRange) Empty() bool {
+	return !r.Start.Before(r.End)
+}
+
+// Contains reports whether t is in the range
+func (r TimeRange) Contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+// Overlaps reports whether the two ranges share any time, the adjacent ranges are not overlapped
+func (r TimeRange) Overlaps(o TimeRange) bool {
+	return !r.Empty() && !o.Empty() && r.Start.Before(o.End) && o.Start.Before(r.End)
+}
+
+// Intersect returns the time shared by the two ranges, false if they are not overlapped
+func (r TimeRange) Intersect(o TimeRange) (TimeRange, bool) {
+	if !r.Overlaps(o) {
+		return TimeRange{}, false
+	}
+
+	result := r
+	if o.Start.After(result.Start) {
+		result.Start = o.Start
+	}
+	if o.End.Before(result.End) {
+		result.End = o.End
+	}
+	return result, true
+}
+
+// Subtract returns the parts of range not covered by o, at most two ranges
+func (r TimeRange) Subtract(o TimeRange) []TimeRange {
+	if !r.Overlaps(o) {
+		if r.Empty() {
+			return nil
+		}
+		return []TimeRange{r}
+	}
+
+	result := []TimeRange{}
+	if r.Start.Before(o.Start) {
+		result = append(result, TimeRange{Start: r.Start, End: o.Start})
+	}
+	if o.End.Before(r.End) {
+		result = append(result, TimeRange{Start: o.End, End: r.End})
+	}
+	return result
+}
+
+// MergeRanges merges the overlapped and adjacent ranges, returns the ranges sorted by start
+// without the empty ones, the given slice is not modified
+func MergeRanges(ranges []TimeRange) []TimeRange {
+	sorted := make([]TimeRange, 0, len(ranges))
+	for _, r := range ranges {
+		if !r.Empty() {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	result := []TimeRange{}
+	for _, r := range sorted {
+		if n := len(result); n > 0 && !r.Start.After(result[n-1].End) {
+			if r.End.After(result[n-1].End) {
+				result[n-1].End = r.End
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
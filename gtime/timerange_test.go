@@ -0,0 +1,31 @@
+package gtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeRange(t *testing.T) {
+	base := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := func(from, to int) TimeRange {
+		return TimeRange{Start: base.Add(time.Duration(from) * time.Hour), End: base.Add(time.Duration(to) * time.Hour)}
+	}
+
+	if !r(0, 2).Overlaps(r(1, 3)) || r(0, 1).Overlaps(r(1, 2)) || r(0, 2).Overlaps(r(1, 1)) {
+		t.Error("Should overlap only when sharing time")
+	}
+	if i, ok := r(0, 2).Intersect(r(1, 3)); !ok || i != r(1, 2) {
+		t.Errorf("Should intersect at [1, 2), but (%v, %v)", i, ok)
+	}
+	if parts := r(0, 4).Subtract(r(1, 2)); len(parts) != 2 || parts[0] != r(0, 1) || parts[1] != r(2, 4) {
+		t.Errorf("Should split into two parts, but (%v)", parts)
+	}
+	if !r(0, 1).Contains(base) || r(0, 1).Contains(base.Add(time.Hour)) || NewTimeRange(base, -time.Hour).Duration() != time.Hour {
+		t.Error("Should be half-open")
+	}
+
+	merged := MergeRanges([]TimeRange{r(5, 6), r(0, 2), r(3, 3), r(1, 3), r(3, 4)})
+	if len(merged) != 2 || merged[0] != r(0, 4) || merged[1] != r(5, 6) {
+		t.Errorf("Should merge into [0, 4) and [5, 6), but (%v)", merged)
+	}
+}
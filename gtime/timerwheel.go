@@ -1,13 +1,11 @@
 package gtime
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/xtfly/gokits/grand"
 )
 
 const (
@@ -15,75 +13,201 @@ const (
 	defaultWheelCount   = 512
 )
 
-// TimerWheel 时钟轮
+// TimerWheel 分层时钟轮（Kafka 风格），第 0 层每个卡槽为一个 tick，
+// 超出当前层范围的定时器放入按需创建的上层时钟轮，上层卡槽到期时降级重新插入，
+// 插入和取消均为 O(1)，长延时定时器不需要每个 tick 递减圈数
 type TimerWheel struct {
-	lock          sync.Mutex    // 锁
-	tickDuration  time.Duration // 卡槽每次跳动的时间间隔
-	roundDuration time.Duration // 一轮耗时
-	wheelCount    int           // 卡槽数
-	wheel         []*iterator   // 卡槽
-	quit          chan struct{} // 退出
-	wheelCursor   int           // 当前卡槽位置
+	lock         sync.Mutex               // 锁
+	tickDuration time.Duration            // 卡槽每次跳动的时间间隔
+	wheelCount   int                      // 每层卡槽数
+	wheel        *timingWheel             // 第 0 层时钟轮
+	timers       map[uint64]*wheelTimeOut // 定时器索引
+	quit         chan struct{}            // 退出
+	currentTick  int64                    // 已跳动的 tick 数
+	lastID       uint64                   // 单调递增的定时器标识
+	clock        Clock                    // 时钟
+	pending      time.Duration            // 手动推进时不足一个 tick 的时间
+	startAt      time.Time                // Start 的时间，用于追赶丢失的 tick 和统计延迟
+	executor     Executor                 // 执行回调
+	chanPolicy   ChanPolicy               // 到期事件的投递策略
+	panicFunc    func(recovered interface{})
+	stats        twStats
+}
+
+// firing is a expiration of timer, the timer may be rescheduled before dispatched
+type firing struct {
+	timeOut    *wheelTimeOut
+	expiration int64 // 到期的 tick
+	last       bool  // 最后一次到期
+}
+
+// timingWheel is a level of hierarchical timer wheel
+type timingWheel struct {
+	tick     int64        // 每个卡槽的 tick 数
+	interval int64        // 本层覆盖的 tick 数
+	current  int64        // 当前时间，按 tick 对齐
+	buckets  []*bucket    // 卡槽
+	overflow *timingWheel // 上层时钟轮
 }
 
-// iterator is a iterator for wheel timeout
-type iterator struct {
-	items map[string]*wheelTimeOut
+// bucket is a doubly linked list of timeouts expire in the same slot
+type bucket struct {
+	expiration int64 // 卡槽到期的 tick，-1 表示空
+	head       wheelTimeOut
 }
 
 // wheelTimeOut is a object to process timeout event
 type wheelTimeOut struct {
-	id       string        // 定时器标识
-	delay    time.Duration // 延迟时间
-	index    int           // 卡槽索引位置
-	rounds   int           // 需要转动的周期数
-	task     func()        // 到期执行的任务
-	outCh    chan struct{} // 到期事件队列
-	times    int           // 超时设定的次数
-	expTimes int           // 已超时的次数
+	id         uint64        // 定时器标识
+	delay      time.Duration // 延迟时间
+	expiration int64         // 到期的 tick
+	bucket     *bucket       // 所在卡槽
+	prev, next *wheelTimeOut // 卡槽链表
+	task       func()        // 到期执行的任务
+	outCh      chan struct{} // 到期事件队列
+	times      int           // 超时设定的次数
+	expTimes   int           // 已超时的次数
 }
 
 // TwOption is the configuration of TimerWheel
 type TwOption struct {
 	TickDuration time.Duration `json:"tick_duration" yaml:"tick_duration"`
 	WheelCount   int           `json:"wheel_count" yaml:"wheel_count"`
+	Clock        Clock         `json:"-" yaml:"-"` // drive the ticker of Start, default RealClock
+	// Executor runs the callbacks of AfterFunc, e.g. InlineExecutor, BoundedExecutor or
+	// gconcurrent.CronExecutor, default a new goroutine per callback
+	Executor   Executor   `json:"-" yaml:"-"`
+	ChanPolicy ChanPolicy `json:"chan_policy" yaml:"chan_policy"` // delivery of the events of After, default ChanCoalesce
+	// PanicFunc process the panic of callbacks, the panic is recovered even if it is nil
+	PanicFunc func(recovered interface{}) `json:"-" yaml:"-"`
 }
 
 // NewTimerWheel create a instance of TimerWheel with given options
 func NewTimerWheel(opt ...TwOption) *TimerWheel {
 	tw := &TimerWheel{
-		tickDuration:  defaultTickDuration,
-		wheelCount:    defaultWheelCount,
-		quit:          make(chan struct{}),
-		wheelCursor:   0,
-		roundDuration: defaultTickDuration * defaultWheelCount,
+		tickDuration: defaultTickDuration,
+		wheelCount:   defaultWheelCount,
+		timers:       make(map[uint64]*wheelTimeOut),
+		quit:         make(chan struct{}),
+		clock:        RealClock,
+		executor:     goExecutor,
 	}
 
 	if len(opt) >= 1 {
 		tw.tickDuration = opt[0].TickDuration
 		tw.wheelCount = opt[0].WheelCount
+		tw.chanPolicy = opt[0].ChanPolicy
+		tw.panicFunc = opt[0].PanicFunc
+		if opt[0].Clock != nil {
+			tw.clock = opt[0].Clock
+		}
+		if opt[0].Executor != nil {
+			tw.executor = opt[0].Executor
+		}
 	}
 
-	tw.roundDuration = tw.tickDuration * time.Duration(tw.wheelCount)
-	tw.createWheel(tw.wheelCount)
+	tw.wheel = newTimingWheel(1, tw.wheelCount, 0)
 	return tw
 }
 
-// Start a ticker for check expired items
+func newTimingWheel(tick int64, wheelCount int, current int64) *timingWheel {
+	w := &timingWheel{
+		tick:     tick,
+		interval: tick * int64(wheelCount),
+		current:  current - current%tick,
+		buckets:  make([]*bucket, wheelCount),
+	}
+	for i := range w.buckets {
+		b := &bucket{expiration: -1}
+		b.head.prev, b.head.next = &b.head, &b.head
+		w.buckets[i] = b
+	}
+	return w
+}
+
+// add the timeout into the level which covers its expiration, returns false if it is expired
+func (w *timingWheel) add(timeOut *wheelTimeOut) bool {
+	if timeOut.expiration < w.current+w.tick {
+		return false
+	}
+
+	if timeOut.expiration < w.current+w.interval {
+		b := w.buckets[(timeOut.expiration/w.tick)%int64(len(w.buckets))]
+		b.add(timeOut)
+		b.expiration = timeOut.expiration - timeOut.expiration%w.tick
+		return true
+	}
+
+	if w.overflow == nil {
+		w.overflow = newTimingWheel(w.interval, len(w.buckets), w.current)
+	}
+	return w.overflow.add(timeOut)
+}
+
+// advance the current time of all levels to tick
+func (w *timingWheel) advance(tick int64) {
+	for ; w != nil && tick >= w.current+w.tick; w = w.overflow {
+		w.current = tick - tick%w.tick
+	}
+}
+
+// flush removes the timeouts of the buckets expired at tick, from the highest level
+func (w *timingWheel) flush(tick int64, timeOuts []*wheelTimeOut) []*wheelTimeOut {
+	if w.overflow != nil {
+		timeOuts = w.overflow.flush(tick, timeOuts)
+	}
+	if tick%w.tick != 0 {
+		return timeOuts
+	}
+
+	b := w.buckets[(tick/w.tick)%int64(len(w.buckets))]
+	if b.expiration < 0 || b.expiration > tick {
+		return timeOuts
+	}
+	b.expiration = -1
+	for timeOut := b.head.next; timeOut != &b.head; {
+		next := timeOut.next
+		b.remove(timeOut)
+		timeOuts = append(timeOuts, timeOut)
+		timeOut = next
+	}
+	return timeOuts
+}
+
+func (b *bucket) add(timeOut *wheelTimeOut) {
+	timeOut.bucket = b
+	timeOut.prev, timeOut.next = b.head.prev, &b.head
+	b.head.prev.next = timeOut
+	b.head.prev = timeOut
+}
+
+func (b *bucket) remove(timeOut *wheelTimeOut) {
+	timeOut.prev.next = timeOut.next
+	timeOut.next.prev = timeOut.prev
+	timeOut.prev, timeOut.next, timeOut.bucket = nil, nil, nil
+}
+
+// Start a ticker for check expired items, the ticks dropped by the ticker
+// when the wheel is busy are caught up by the elapsed time
 func (t *TimerWheel) Start() {
-	tick := time.NewTicker(t.tickDuration)
+	t.lock.Lock()
+	t.startAt = t.clock.Now().Add(-time.Duration(t.currentTick) * t.tickDuration)
+	startAt := t.startAt
+	t.lock.Unlock()
+
+	tick := t.clock.NewTicker(t.tickDuration)
 	go func() {
 		for {
 			select {
-			case <-tick.C:
-				t.wheelCursor++
-				if t.wheelCursor == t.wheelCount {
-					t.wheelCursor = 0
+			case <-tick.C():
+				target := int64(t.clock.Now().Sub(startAt) / t.tickDuration)
+				for {
+					firings, ok := t.fetchExpiredTimeoutsUntil(target)
+					if !ok {
+						break
+					}
+					t.notifyExpiredTimeOut(firings, t.executor, true)
 				}
-
-				iterator := t.wheel[t.wheelCursor]
-				tasks := t.fetchExpiredTimeouts(iterator)
-				t.notifyExpiredTimeOut(tasks)
 			case <-t.quit:
 				tick.Stop()
 				return
@@ -97,22 +221,52 @@ func (t *TimerWheel) Stop() {
 	t.quit <- struct{}{}
 }
 
-func (t *TimerWheel) createWheel(wheelCount int) {
-	arr := make([]*iterator, wheelCount)
-	for v := 0; v < wheelCount; v++ {
-		arr[v] = &iterator{items: make(map[string]*wheelTimeOut)}
+// Advance drives the wheel manually by d instead of Start, the remainder less than a tick is
+// accumulated. The callbacks expired are executed in the calling goroutine before it returns,
+// so the timers could be tested deterministically
+func (t *TimerWheel) Advance(d time.Duration) {
+	t.lock.Lock()
+	t.pending += d
+	ticks := t.pending / t.tickDuration
+	t.pending %= t.tickDuration
+	t.lock.Unlock()
+
+	for ; ticks > 0; ticks-- {
+		t.notifyExpiredTimeOut(t.fetchExpiredTimeouts(), InlineExecutor, false)
+	}
+}
+
+// Stats return the statistics of timer wheel
+func (t *TimerWheel) Stats() TwStats {
+	t.lock.Lock()
+	timers := len(t.timers)
+	t.lock.Unlock()
+
+	return TwStats{
+		Timers:      timers,
+		Fired:       atomic.LoadInt64(&t.stats.fired),
+		Late:        atomic.LoadInt64(&t.stats.late),
+		MaxLateness: time.Duration(atomic.LoadInt64(&t.stats.maxLateness)),
+		Dropped:     atomic.LoadInt64(&t.stats.dropped),
+		Panics:      atomic.LoadInt64(&t.stats.panics),
 	}
-	t.wheel = arr
+}
+
+// elapsed returns the time of wheel by the ticks, it is advanced by Start or Advance
+func (t *TimerWheel) elapsed() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return time.Duration(t.currentTick) * t.tickDuration
 }
 
 // AfterFunc add a timer callback function which will trigger after the given interval time and trigger times
-func (t *TimerWheel) AfterFunc(interval time.Duration, times int, f func()) (string, error) {
+func (t *TimerWheel) AfterFunc(interval time.Duration, times int, f func()) (*Timer, error) {
 	if f == nil {
-		return "", errors.New("timer callback function is empty")
+		return nil, errors.New("timer callback function is empty")
 	}
 
 	if interval <= 0 {
-		return "", errors.New("interval Must be greater than zero")
+		return nil, errors.New("interval Must be greater than zero")
 	}
 
 	if times <= 0 {
@@ -125,14 +279,19 @@ func (t *TimerWheel) AfterFunc(interval time.Duration, times int, f func()) (str
 		times: times,
 	}
 
-	tid := t.scheduleTimeOut(timeOut)
-	return tid, nil
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastID++
+	timeOut.id = t.lastID
+	t.scheduleTimeOut(timeOut)
+	return &Timer{wheel: t, timeOut: timeOut}, nil
 }
 
-// After add a timer using the given interval time
-func (t *TimerWheel) After(interval time.Duration, times int) (chan struct{}, string, error) {
+// After add a timer using the given interval time, the channel is closed after the last trigger,
+// the events are delivered without blocking by the ChanPolicy of wheel
+func (t *TimerWheel) After(interval time.Duration, times int) (chan struct{}, *Timer, error) {
 	if interval <= 0 {
-		return nil, "", errors.New("interval Must be greater than zero")
+		return nil, nil, errors.New("interval Must be greater than zero")
 	}
 
 	if times <= 0 {
@@ -144,114 +303,146 @@ func (t *TimerWheel) After(interval time.Duration, times int) (chan struct{}, st
 		outCh: make(chan struct{}),
 		times: times,
 	}
+	if t.chanPolicy == ChanCoalesce {
+		timeOut.outCh = make(chan struct{}, 1)
+	}
 
-	tid := t.scheduleTimeOut(timeOut)
-	return timeOut.outCh, tid, nil
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastID++
+	timeOut.id = t.lastID
+	t.scheduleTimeOut(timeOut)
+	return timeOut.outCh, &Timer{wheel: t, timeOut: timeOut}, nil
 }
 
-// Cancel the timer
+// Cancel the timer by the id of Timer like Timer.Stop,
+// returns an error if the timer is unknown, has been stopped or expired
 func (t *TimerWheel) Cancel(timerID string) error {
+	id, err := strconv.ParseUint(timerID, 10, 64)
+	if err != nil {
+		return errors.New("invalid timer id")
+	}
+
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	for _, it := range t.wheel {
-		delete(it.items, timerID)
+	timeOut, ok := t.timers[id]
+	if !ok {
+		return errors.New("timer not found")
 	}
+	t.removeTimeOut(timeOut)
 	return nil
 }
 
-func (t *TimerWheel) scheduleTimeOut(timeOut *wheelTimeOut) string {
-	if timeOut.delay < t.tickDuration {
-		timeOut.delay = t.tickDuration
+// removeTimeOut 从索引和卡槽中移除定时器，必须持有锁
+func (t *TimerWheel) removeTimeOut(timeOut *wheelTimeOut) {
+	delete(t.timers, timeOut.id)
+	if timeOut.bucket != nil {
+		timeOut.bucket.remove(timeOut)
 	}
-	lastRoundDelay := timeOut.delay % t.roundDuration
-	lastTickDelay := timeOut.delay % t.tickDuration
+}
 
-	// 计算卡槽位置
-	relativeIndex := lastRoundDelay / t.tickDuration
-	if lastTickDelay != 0 {
-		relativeIndex = relativeIndex + 1
-	}
-	// 计算时间轮圈数
-	remainingRounds := timeOut.delay / t.roundDuration
-	if lastRoundDelay == 0 {
-		remainingRounds = remainingRounds - 1
+// scheduleTimeOut 按延迟计算到期 tick 并插入时钟轮，必须持有锁
+func (t *TimerWheel) scheduleTimeOut(timeOut *wheelTimeOut) {
+	ticks := int64(timeOut.delay / t.tickDuration)
+	if timeOut.delay%t.tickDuration != 0 || ticks == 0 {
+		ticks++
 	}
+	timeOut.expiration = t.currentTick + ticks
+	t.timers[timeOut.id] = timeOut
+	t.wheel.add(timeOut)
+}
 
+// 跳动一个 tick，取出到期的定时器，上层卡槽中未到期的定时器降级重新插入
+func (t *TimerWheel) fetchExpiredTimeouts() []firing {
 	t.lock.Lock()
 	defer t.lock.Unlock()
-
-	stopIndex := t.wheelCursor + int(relativeIndex)
-	if stopIndex >= t.wheelCount {
-		stopIndex = stopIndex - t.wheelCount
-		timeOut.rounds = int(remainingRounds) + 1
-	} else {
-		timeOut.rounds = int(remainingRounds)
-	}
-	timeOut.index = stopIndex
-	item := t.wheel[stopIndex]
-	if item == nil {
-		item = &iterator{
-			items: make(map[string]*wheelTimeOut),
-		}
-	}
-
-	if timeOut.id == "" {
-		timeOut.id = t.guid()
-	}
-
-	item.items[timeOut.id] = timeOut
-	t.wheel[stopIndex] = item
-
-	return timeOut.id
+	return t.tick()
 }
 
-// 判断当前卡槽中是否有超时任务,将超时task加入切片中
-func (t *TimerWheel) fetchExpiredTimeouts(iter *iterator) []*wheelTimeOut {
+// 跳动一个 tick，返回 false 表示已追上 target
+func (t *TimerWheel) fetchExpiredTimeoutsUntil(target int64) ([]firing, bool) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
+	if t.currentTick >= target {
+		return nil, false
+	}
+	return t.tick(), true
+}
 
-	task := []*wheelTimeOut{}
+// tick 必须持有锁
+func (t *TimerWheel) tick() []firing {
+	t.currentTick++
+	t.wheel.advance(t.currentTick)
+
+	firings := []firing{}
+	for _, timeOut := range t.wheel.flush(t.currentTick, nil) {
+		if t.wheel.add(timeOut) {
+			continue
+		}
 
-	for k, v := range iter.items {
-		if v.rounds <= 0 { //已经超时了
-			task = append(task, v)
-			delete(iter.items, k)
+		//已经超时了
+		f := firing{timeOut: timeOut, expiration: timeOut.expiration}
+		timeOut.expTimes++
+		if timeOut.expTimes < timeOut.times { // 如果执行的次数小于设置的次数，则再次调度
+			t.scheduleTimeOut(timeOut)
 		} else {
-			v.rounds--
+			f.last = true
+			delete(t.timers, timeOut.id)
 		}
+		firings = append(firings, f)
 	}
 
-	return task
+	return firings
 }
 
-// 执行超时任务
-func (t *TimerWheel) notifyExpiredTimeOut(tasks []*wheelTimeOut) {
-	for _, task := range tasks {
-		task.expTimes++
-		if task.expTimes < task.times { // 如果执行的次数小于设置的次数，则再次调度
-			_ = t.scheduleTimeOut(task)
+// 执行超时任务，回调由 executor 执行，到期事件以非阻塞方式投递
+func (t *TimerWheel) notifyExpiredTimeOut(firings []firing, executor Executor, measure bool) {
+	for _, f := range firings {
+		atomic.AddInt64(&t.stats.fired, 1)
+		f := f
+		if f.timeOut.task != nil {
+			executor.Execute(func() {
+				if measure {
+					t.measure(f)
+				}
+				t.runTask(f.timeOut.task)
+			})
+			continue
 		}
 
-		if task.task != nil {
-			go task.task()
-		} else {
-			go func(times int) {
-				task.outCh <- struct{}{}
-				if times == task.times {
-					close(task.outCh)
-				}
-			}(task.expTimes)
+		if measure {
+			t.measure(f)
 		}
+		t.deliver(f)
 	}
 }
 
-func (t *TimerWheel) md5str(s string) string {
-	h := md5.New()
-	h.Write([]byte(s))
-	return hex.EncodeToString(h.Sum(nil))
+// deliver the event of After by the policy without blocking, only the wheel goroutine sends
+func (t *TimerWheel) deliver(f firing) {
+	select {
+	case f.timeOut.outCh <- struct{}{}:
+	default:
+		atomic.AddInt64(&t.stats.dropped, 1)
+	}
+	if f.last {
+		close(f.timeOut.outCh)
+	}
+}
 
+// measure the delay between the deadline and now
+func (t *TimerWheel) measure(f firing) {
+	deadline := t.startAt.Add(time.Duration(f.expiration) * t.tickDuration)
+	t.stats.recordLateness(t.clock.Now().Sub(deadline), t.tickDuration)
 }
 
-func (t *TimerWheel) guid() string {
-	return grand.NewUUID()
+func (t *TimerWheel) runTask(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&t.stats.panics, 1)
+			if t.panicFunc != nil {
+				t.panicFunc(r)
+			}
+		}
+	}()
+	task()
 }
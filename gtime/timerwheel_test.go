@@ -13,11 +13,16 @@ var (
 	}
 )
 
+func bucketHasTimer(w *timingWheel, index int) bool {
+	b := w.buckets[index]
+	return b.head.next != &b.head
+}
+
 func TestScheculer(t *testing.T) {
 	wheel := NewTimerWheel()
 
 	wheel.AfterFunc(4*time.Second, 1, expfunc)
-	if len(wheel.wheel[40].items) == 0 {
+	if !bucketHasTimer(wheel.wheel, 40) {
 		t.Fail()
 	}
 }
@@ -25,7 +30,8 @@ func TestScheculer(t *testing.T) {
 func TestScheculer1(t *testing.T) {
 	wheel := NewTimerWheel()
 	wheel.AfterFunc(1*time.Minute, 1, expfunc)
-	if len(wheel.wheel[88].items) == 0 {
+	// 600 ticks is beyond the first level, it is in the overflow level
+	if wheel.wheel.overflow == nil || !bucketHasTimer(wheel.wheel.overflow, 1) {
 		t.Fail()
 	}
 
@@ -72,8 +78,96 @@ func TestNotifyTask3timesUseCh(t *testing.T) {
 func TestRemove(t *testing.T) {
 	wheel := NewTimerWheel()
 	wheel.Start()
-	tid, _ := wheel.AfterFunc(3*time.Second, 1, expfunc)
+	timer, _ := wheel.AfterFunc(3*time.Second, 1, expfunc)
 	time.Sleep(1 * time.Millisecond)
-	wheel.Cancel(tid)
+	wheel.Cancel(timer.ID())
 	time.Sleep(3 * time.Millisecond)
 }
+
+func TestHierarchicalCascade(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: time.Millisecond, WheelCount: 8})
+
+	var fired []int64
+	for _, d := range []int64{1, 7, 8, 9, 64, 65, 600} {
+		wheel.AfterFunc(time.Duration(d)*time.Millisecond, 1, expfunc)
+	}
+
+	for tick := int64(1); tick <= 600; tick++ {
+		for _, task := range wheel.fetchExpiredTimeouts() {
+			if task.expiration != tick {
+				t.Fatalf("Timer of tick %d fired at tick %d", task.expiration, tick)
+			}
+			fired = append(fired, tick)
+		}
+	}
+	if len(fired) != 7 || len(wheel.timers) != 0 {
+		t.Fatalf("Should fire all timers once, but (%v)", fired)
+	}
+}
+
+func TestCancelRepeat(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: time.Millisecond, WheelCount: 8})
+	timer, _ := wheel.AfterFunc(20*time.Millisecond, 0, expfunc)
+
+	fired := 0
+	for tick := 0; tick < 100; tick++ {
+		fired += len(wheel.fetchExpiredTimeouts())
+		if fired == 2 {
+			timer.Stop()
+		}
+	}
+	if fired != 2 || len(wheel.timers) != 0 {
+		t.Fatalf("Should stop repeating after cancel, but (%d)", fired)
+	}
+}
+
+func TestTimerHandle(t *testing.T) {
+	wheel := NewTimerWheel(TwOption{TickDuration: time.Millisecond, WheelCount: 8})
+	timer, _ := wheel.AfterFunc(50*time.Millisecond, 1, expfunc)
+	other, _ := wheel.AfterFunc(50*time.Millisecond, 1, expfunc)
+	if timer.ID() == other.ID() {
+		t.Fatalf("Timer id should be unique, but (%s)", timer.ID())
+	}
+
+	wheel.fetchExpiredTimeouts()
+	if d := timer.Remaining(); d != 49*time.Millisecond {
+		t.Fatalf("Should remain 49ms, but (%v)", d)
+	}
+	if !timer.Reset(10 * time.Millisecond) {
+		t.Fatalf("Should reset a active timer")
+	}
+	if d := timer.Remaining(); d != 10*time.Millisecond {
+		t.Fatalf("Should remain 10ms after reset, but (%v)", d)
+	}
+
+	fired := 0
+	for tick := 0; tick < 10; tick++ {
+		fired += len(wheel.fetchExpiredTimeouts())
+	}
+	if fired != 1 || timer.Remaining() != 0 || timer.Stop() {
+		t.Fatalf("Should fire once and be inactive, but (%d)", fired)
+	}
+
+	if !other.Stop() || other.Stop() {
+		t.Fatalf("Should stop the timer only once")
+	}
+	if len(wheel.timers) != 0 {
+		t.Fatalf("Should have no timer, but (%d)", len(wheel.timers))
+	}
+	if err := wheel.Cancel("invalid"); err == nil {
+		t.Fatalf("Should reject invalid id")
+	}
+	if err := wheel.Cancel(other.ID()); err == nil {
+		t.Fatalf("Should reject the stopped timer")
+	}
+}
+
+func BenchmarkAfterFunc(b *testing.B) {
+	wheel := NewTimerWheel()
+	for i := 0; i < b.N; i++ {
+		timer, _ := wheel.AfterFunc(time.Duration(i%100000)*time.Millisecond+time.Millisecond, 1, expfunc)
+		if i%2 == 0 {
+			timer.Stop()
+		}
+	}
+}